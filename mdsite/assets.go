@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Asset is a static file that templates link to through the Asset function.
+// When building into an output directory it's written under a name that
+// includes a hash of its content, such as bundle.3f9a1c.js, so browsers
+// never use a stale copy after a deploy.
+type Asset struct {
+	// Path relative to the site root, such as yoto/bundle.js
+	Name string `json:"-"`
+	// Path of the fingerprinted copy, relative to the site root
+	File string `json:"file"`
+	URL  string `json:"url"`
+	// Subresource integrity hash for the integrity attribute
+	Integrity string `json:"integrity"`
+
+	path string
+}
+
+type assetSet struct {
+	rootDir     string
+	urlPath     string
+	fingerprint bool
+	patterns    []string
+	assets      map[string]*Asset
+	// Combined hash of every asset, for the build cache
+	hash string
+}
+
+// loadAssets hashes every file under rootDir matching patterns. Fingerprinted
+// names are only used when fingerprint is set, otherwise assets are linked
+// where they are.
+func loadAssets(rootDir, siteURLPath string, patterns []string, fingerprint bool) (*assetSet, error) {
+	s := &assetSet{
+		rootDir:     rootDir,
+		urlPath:     siteURLPath,
+		fingerprint: fingerprint,
+		patterns:    patterns,
+		assets:      map[string]*Asset{},
+	}
+	if len(patterns) == 0 {
+		return s, nil
+	}
+
+	err := filepath.Walk(rootDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("Error accessing file %s: %w", filePath, err)
+		}
+		if info.IsDir() {
+			if isSkippedDir(filePath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(rootDir, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		if !matchesAny(name, patterns) {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("Error reading asset %s: %w", filePath, err)
+		}
+
+		output := name
+		if fingerprint {
+			output = fingerprintName(name, content)
+		}
+		sri := sha512.Sum384(content)
+		s.assets[name] = &Asset{
+			Name:      name,
+			File:      output,
+			URL:       path.Join("/", siteURLPath, output),
+			Integrity: "sha384-" + base64.StdEncoding.EncodeToString(sri[:]),
+			path:      filePath,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range s.assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "fingerprint %t\n", fingerprint)
+	for _, name := range names {
+		fmt.Fprintf(h, "asset %s %s\n", name, s.assets[name].Integrity)
+	}
+	s.hash = hex.EncodeToString(h.Sum(nil))
+
+	return s, nil
+}
+
+// lookup returns the asset with the given name, resolved like a link on page:
+// relative to the page's directory unless it starts with a slash. A name that
+// matches a pattern under assets but no file is an error, or returns nil when
+// optional is set so templates can skip assets only some pages have.
+func (s *assetSet) lookup(page *Page, name string, optional bool) (*Asset, error) {
+	relPath := strings.TrimPrefix(name, "/")
+	if !strings.HasPrefix(name, "/") {
+		rel, err := filepath.Rel(s.rootDir, filepath.Join(page.Dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		relPath = filepath.ToSlash(rel)
+	}
+
+	if asset, ok := s.assets[relPath]; ok {
+		return asset, nil
+	}
+	if matchesAny(relPath, s.patterns) {
+		if optional {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Missing asset %s, it matches a pattern under assets in %s but doesn't exist", relPath, configFileName)
+	}
+
+	// Files outside the patterns are still linked when building in place
+	if !s.fingerprint {
+		return &Asset{Name: relPath, File: relPath, URL: path.Join("/", s.urlPath, relPath)}, nil
+	}
+	return nil, fmt.Errorf("Unknown asset %s, it must exist and match a pattern under assets in %s", relPath, configFileName)
+}
+
+// write copies each asset to its fingerprinted name under outDir and writes
+// a manifest mapping asset names to their URLs and integrity hashes to
+// manifestPath. Fingerprinted copies listed in the previous manifest that are
+// no longer current are removed.
+func (s *assetSet) write(outDir, manifestPath string) error {
+	if !s.fingerprint {
+		return nil
+	}
+
+	current := map[string]bool{}
+	for _, asset := range s.assets {
+		current[asset.File] = true
+	}
+
+	if content, err := ioutil.ReadFile(manifestPath); err == nil {
+		var prev map[string]*Asset
+		if err := json.Unmarshal(content, &prev); err == nil {
+			for _, asset := range prev {
+				if current[asset.File] {
+					continue
+				}
+				stale := filepath.Join(outDir, filepath.FromSlash(asset.File))
+				if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("Error removing stale asset %s: %w", stale, err)
+				}
+			}
+		}
+	}
+
+	for _, asset := range s.assets {
+		if err := copyFile(asset.path, filepath.Join(outDir, filepath.FromSlash(asset.File))); err != nil {
+			return err
+		}
+	}
+
+	content, err := json.MarshalIndent(s.assets, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(manifestPath, content); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %d assets and manifest %s\n", len(s.assets), manifestPath)
+
+	return nil
+}
+
+// fingerprintName inserts a short hash of content before the extension of
+// name, so yoto/bundle.js becomes yoto/bundle.3f9a1c.js.
+func fingerprintName(name string, content []byte) string {
+	sum := sha256.Sum256(content)
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(name, ext), hex.EncodeToString(sum[:])[:6], ext)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestFingerprintName(t *testing.T) {
+	got := fingerprintName("yoto/bundle.js", []byte("console.log(1)"))
+	if !regexp.MustCompile(`^yoto/bundle\.[0-9a-f]{6}\.js$`).MatchString(got) {
+		t.Errorf("fingerprintName = %q, want yoto/bundle.<hash>.js", got)
+	}
+	if other := fingerprintName("yoto/bundle.js", []byte("console.log(2)")); other == got {
+		t.Errorf("fingerprintName gave %q for different content", got)
+	}
+}
+
+func TestAssetLookup(t *testing.T) {
+	rootDir := writeFiles(t, map[string]string{
+		"tailwind.css":   "tailwind.css",
+		"yoto/bundle.js": "yoto/bundle.js",
+		"yoto/notes.txt": "yoto/notes.txt",
+	})
+
+	assets, err := loadAssets(rootDir, "/", []string{"tailwind.css", "*/bundle.js"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := &Page{Dir: filepath.Join(rootDir, "yoto")}
+
+	bundle, err := assets.lookup(page, "bundle.js", false)
+	if err != nil {
+		t.Fatalf("lookup(bundle.js) error: %v", err)
+	}
+	if !regexp.MustCompile(`^/yoto/bundle\.[0-9a-f]{6}\.js$`).MatchString(bundle.URL) {
+		t.Errorf("bundle URL = %q", bundle.URL)
+	}
+	if !regexp.MustCompile(`^sha384-[A-Za-z0-9+/]{64}$`).MatchString(bundle.Integrity) {
+		t.Errorf("bundle integrity = %q", bundle.Integrity)
+	}
+
+	if css, err := assets.lookup(page, "/tailwind.css", false); err != nil || css.Name != "tailwind.css" {
+		t.Errorf("lookup(/tailwind.css) = %+v, %v", css, err)
+	}
+
+	if _, err := assets.lookup(page, "notes.txt", true); err == nil {
+		t.Errorf("lookup of a file not matching any pattern returned no error")
+	}
+
+	// Pages without their own bundle can skip it, but a missing asset
+	// every page needs fails the build
+	other := &Page{Dir: filepath.Join(rootDir, "rings")}
+	if asset, err := assets.lookup(other, "bundle.js", true); err != nil || asset != nil {
+		t.Errorf("optional lookup of a missing bundle = %+v, %v, want nil", asset, err)
+	}
+	if _, err := assets.lookup(other, "bundle.js", false); err == nil {
+		t.Errorf("lookup of a missing bundle returned no error")
+	}
+
+	inPlace, err := loadAssets(rootDir, "/", []string{"tailwind.css", "*/bundle.js"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset, err := inPlace.lookup(other, "bundle.js", true); err != nil || asset != nil {
+		t.Errorf("in place optional lookup of a missing bundle = %+v, %v, want nil", asset, err)
+	}
+	if _, err := inPlace.lookup(other, "bundle.js", false); err == nil {
+		t.Errorf("in place lookup of a missing bundle returned no error")
+	}
+	if notes, err := inPlace.lookup(page, "notes.txt", false); err != nil || notes.URL != "/yoto/notes.txt" {
+		t.Errorf("in place lookup(notes.txt) = %+v, %v", notes, err)
+	}
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/template/parse"
+)
+
+const (
+	manifestFileName = ".mdsite-cache.json"
+
+	// manifestVersion is bumped whenever the way pages are rendered changes
+	// so that outputs written by an older mdsite are never reused.
+	manifestVersion = 1
+)
+
+// Manifest records, for every rendered page, a hash of everything that went
+// into its output so unchanged pages can be skipped on the next build.
+type Manifest struct {
+	Version int                      `json:"version"`
+	OutDir  string                   `json:"outDir"`
+	Pages   map[string]ManifestEntry `json:"pages"`
+}
+
+type ManifestEntry struct {
+	// Output file, relative to the site root
+	Output string `json:"output"`
+	// Combined hash of the page's inputs
+	Hash string `json:"hash"`
+	// Files read with Include during the last render, relative to the site root
+	Includes []string `json:"includes,omitempty"`
+}
+
+// siteDeps describes which site-wide data a template reads through .Site.
+type siteDeps struct {
+	All    bool
+	Pages  bool
+	Tags   map[string]bool
+	Fields map[string]bool
+	// Set when the template calls Asset or AssetIfExists
+	Assets bool
+	// Set when the template calls ImageSet
+	Images bool
+}
+
+type cachedFile struct {
+	hash string
+	deps siteDeps
+}
+
+type buildCache struct {
+	rootDir   string
+	path      string
+	force     bool
+	templates *templateRegistry
+
+	prev *Manifest
+	next *Manifest
+
+	// Hash and dependencies of each template or include, keyed by path
+	files map[string]*cachedFile
+	// Hash of each page's source file
+	sources map[*Page]string
+	// Hash of site.yaml, which every page depends on
+	configHash string
+}
+
+func newManifest(outDir string) *Manifest {
+	return &Manifest{
+		Version: manifestVersion,
+		OutDir:  outDir,
+		Pages:   map[string]ManifestEntry{},
+	}
+}
+
+// manifestPath returns where the build manifest is kept: in the output
+// directory when there is one, so it describes the files next to it, and in
+// the site root otherwise.
+func manifestPath(rootDir, outDir string) string {
+	if outDir != "" {
+		return filepath.Join(outDir, manifestFileName)
+	}
+	return filepath.Join(rootDir, manifestFileName)
+}
+
+// openBuildCache loads the manifest from the previous build. A missing,
+// unreadable or incompatible manifest is treated as empty.
+func openBuildCache(rootDir, outDir string, force bool, templates *templateRegistry) (*buildCache, error) {
+	configHash, err := hashFile(filepath.Join(rootDir, configFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	absOut := ""
+	if outDir != "" {
+		if absOut, err = filepath.Abs(outDir); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &buildCache{
+		rootDir:    rootDir,
+		path:       manifestPath(rootDir, outDir),
+		force:      force,
+		templates:  templates,
+		prev:       newManifest(absOut),
+		next:       newManifest(absOut),
+		files:      map[string]*cachedFile{},
+		sources:    map[*Page]string{},
+		configHash: configHash,
+	}
+
+	if force {
+		return c, nil
+	}
+
+	content, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		return c, nil
+	}
+
+	var prev Manifest
+	if err := json.Unmarshal(content, &prev); err != nil {
+		return c, nil
+	}
+	if prev.Version == manifestVersion && prev.OutDir == absOut && prev.Pages != nil {
+		c.prev = &prev
+	}
+
+	return c, nil
+}
+
+// hasPrevious reports whether a usable manifest from an earlier build was
+// found.
+func (c *buildCache) hasPrevious() bool {
+	return len(c.prev.Pages) > 0
+}
+
+// addSource remembers the hash of a page's markdown file, frontmatter
+// included. It must be called for every page before any pageKey call since
+// listing pages depend on the sources of the pages they list.
+func (c *buildCache) addSource(page *Page, content []byte) {
+	c.sources[page] = hashBytes(content)
+}
+
+// previousIncludes returns the files page included the last time it was
+// rendered.
+func (c *buildCache) previousIncludes(page *Page) []string {
+	includes := []string{}
+	for _, path := range c.prev.Pages[c.pageID(page)].Includes {
+		includes = append(includes, filepath.Join(c.rootDir, path))
+	}
+	return includes
+}
+
+// pageKey hashes every input of page: its source, its templates, the given
+// included files and whatever site-wide data those templates read.
+func (c *buildCache) pageKey(page *Page, includes []string) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "page %s %s\n", page.Path, c.sources[page])
+	fmt.Fprintf(h, "config %s\n", c.configHash)
+
+	deps := siteDeps{Tags: map[string]bool{}, Fields: map[string]bool{}}
+
+	files := []string{}
+	for _, path := range page.Frontmatter.Templates {
+		files = append(files, filepath.Join(c.rootDir, path))
+	}
+	files = append(files, includes...)
+
+	for _, path := range files {
+		f, err := c.file(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "file %s %s\n", path, f.hash)
+		deps.merge(f.deps)
+	}
+
+	// Generated tag pages list the pages with their tag
+	if page.Tag != nil {
+		deps.Tags[page.Tag.Name] = true
+	}
+
+	c.writeSiteDeps(h, page.Site, deps)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isFresh reports whether the output written for page by the previous build
+// was rendered from the same inputs and still exists.
+func (c *buildCache) isFresh(page *Page, key string) bool {
+	if c.force {
+		return false
+	}
+	entry, ok := c.prev.Pages[c.pageID(page)]
+	if !ok || entry.Hash != key || entry.Output != c.relPath(page.OutputFile) {
+		return false
+	}
+	_, err := os.Stat(page.OutputFile)
+	return err == nil
+}
+
+func (c *buildCache) record(page *Page, key string, includes []string) {
+	relIncludes := []string{}
+	for _, path := range includes {
+		relIncludes = append(relIncludes, c.relPath(path))
+	}
+	c.next.Pages[c.pageID(page)] = ManifestEntry{
+		Output:   c.relPath(page.OutputFile),
+		Hash:     key,
+		Includes: relIncludes,
+	}
+}
+
+// prune deletes outputs written by the previous build for pages that are no
+// longer part of the site. Outputs of pages that failed to render are kept.
+func (c *buildCache) prune(pages []*Page) error {
+	current := map[string]bool{}
+	outputs := map[string]bool{}
+	for _, page := range pages {
+		current[c.pageID(page)] = true
+		outputs[c.relPath(page.OutputFile)] = true
+	}
+
+	for id, entry := range c.prev.Pages {
+		if current[id] || outputs[entry.Output] {
+			continue
+		}
+		outputFile := filepath.Join(c.rootDir, entry.Output)
+		if err := os.Remove(outputFile); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Error removing stale output %s: %w", outputFile, err)
+		}
+		fmt.Printf("Removed %s\n", outputFile)
+	}
+	return nil
+}
+
+func (c *buildCache) save() error {
+	content, err := json.MarshalIndent(c.next, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.path, content, 0644); err != nil {
+		return fmt.Errorf("Error writing build manifest %s: %w", c.path, err)
+	}
+	return nil
+}
+
+func (c *buildCache) pageID(page *Page) string {
+	return c.relPath(page.Path)
+}
+
+func (c *buildCache) relPath(path string) string {
+	rel, err := filepath.Rel(c.rootDir, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// file hashes and analyzes a template or include, once per build.
+func (c *buildCache) file(path string) (*cachedFile, error) {
+	if f, ok := c.files[path]; ok {
+		return f, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading template %s: %w", path, err)
+	}
+
+	trees, err := c.templates.trees(path)
+	if err != nil {
+		return nil, err
+	}
+
+	deps := siteDeps{Tags: map[string]bool{}, Fields: map[string]bool{}}
+	for _, tree := range trees {
+		collectSiteDeps(&deps, tree.Root)
+	}
+
+	f := &cachedFile{hash: hashBytes(content), deps: deps}
+	c.files[path] = f
+	return f, nil
+}
+
+// writeSiteDeps writes the site-wide data described by deps to h.
+func (c *buildCache) writeSiteDeps(h io.Writer, site *Site, deps siteDeps) {
+	if deps.All || deps.Fields["GitSHA"] {
+		fmt.Fprintf(h, "gitsha %s\n", site.GitSHA)
+	}
+	if deps.All || deps.Fields["LastBuild"] {
+		fmt.Fprintf(h, "lastbuild %s\n", site.LastBuild)
+	}
+	if deps.All || deps.Fields["Data"] {
+		fmt.Fprintf(h, "data %s\n", site.dataHash)
+	}
+	if deps.Assets && c.templates.assets != nil {
+		fmt.Fprintf(h, "assets %s\n", c.templates.assets.hash)
+	}
+
+	// Image dimensions only change along with the files, which are usually
+	// the images set in frontmatter
+	if deps.Images {
+		for _, p := range site.Pages {
+			if p.Frontmatter.Image == "" {
+				continue
+			}
+			if info, err := os.Stat(localPath(c.rootDir, p, p.Frontmatter.Image)); err == nil {
+				fmt.Fprintf(h, "image %s %d %s\n", p.Frontmatter.Image, info.Size(), info.ModTime())
+			}
+		}
+	}
+
+	if deps.All || deps.Pages {
+		for _, p := range site.Pages {
+			fmt.Fprintf(h, "site page %s %s\n", p.Path, c.contentHash(p))
+		}
+		return
+	}
+
+	tags := []string{}
+	for tag := range deps.Tags {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for _, tag := range tags {
+		fmt.Fprintf(h, "tag %s\n", tag)
+		for _, p := range site.PagesByTag[tag] {
+			fmt.Fprintf(h, "tag page %s %s\n", p.Path, c.contentHash(p))
+		}
+	}
+}
+
+// contentHash identifies what other pages can see of p: its source and the
+// templates of the shortcodes in it.
+func (c *buildCache) contentHash(p *Page) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", c.sources[p])
+	for _, name := range shortcodeNames(p.Markdown) {
+		path := filepath.Join(c.rootDir, shortcodeDir, name+".html")
+		if f, err := c.file(path); err == nil {
+			fmt.Fprintf(h, "shortcode %s %s\n", name, f.hash)
+		} else {
+			fmt.Fprintf(h, "shortcode %s missing\n", name)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (d *siteDeps) merge(other siteDeps) {
+	d.All = d.All || other.All
+	d.Pages = d.Pages || other.Pages
+	d.Assets = d.Assets || other.Assets
+	d.Images = d.Images || other.Images
+	for tag := range other.Tags {
+		d.Tags[tag] = true
+	}
+	for field := range other.Fields {
+		d.Fields[field] = true
+	}
+}
+
+// addSiteRef records a reference to .Site followed by the given field names.
+// References that hand .Site or one of its page collections to something we
+// can't follow, such as a variable or index call, depend on everything.
+func (d *siteDeps) addSiteRef(fields []string) {
+	switch {
+	case len(fields) == 0:
+		d.All = true
+	case fields[0] == "Pages", fields[0] == "Tags", fields[0] == "TagURL":
+		d.Pages = true
+	case fields[0] == "PagesByTag":
+		if len(fields) == 1 {
+			d.Pages = true
+		} else {
+			d.Tags[fields[1]] = true
+		}
+	default:
+		d.Fields[fields[0]] = true
+	}
+}
+
+func collectSiteDeps(deps *siteDeps, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectSiteDeps(deps, child)
+		}
+	case *parse.ActionNode:
+		collectSiteDeps(deps, n.Pipe)
+	case *parse.IfNode:
+		collectBranchDeps(deps, &n.BranchNode)
+	case *parse.RangeNode:
+		collectBranchDeps(deps, &n.BranchNode)
+	case *parse.WithNode:
+		collectBranchDeps(deps, &n.BranchNode)
+	case *parse.TemplateNode:
+		if n.Pipe != nil {
+			collectSiteDeps(deps, n.Pipe)
+		}
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectSiteDeps(deps, cmd)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectSiteDeps(deps, arg)
+		}
+	case *parse.IdentifierNode:
+		switch n.Ident {
+		case "Asset", "AssetIfExists":
+			deps.Assets = true
+		case "ImageSet":
+			deps.Images = true
+		case "Now":
+			// Like the build time, Now changes on every build
+			deps.Fields["LastBuild"] = true
+		}
+	case *parse.ChainNode:
+		collectSiteDeps(deps, n.Node)
+	case *parse.FieldNode:
+		collectIdentDeps(deps, n.Ident)
+	case *parse.VariableNode:
+		collectIdentDeps(deps, n.Ident[1:])
+	}
+}
+
+func collectBranchDeps(deps *siteDeps, n *parse.BranchNode) {
+	collectSiteDeps(deps, n.Pipe)
+	collectSiteDeps(deps, n.List)
+	if n.ElseList != nil {
+		collectSiteDeps(deps, n.ElseList)
+	}
+}
+
+func collectIdentDeps(deps *siteDeps, ident []string) {
+	for i, name := range ident {
+		switch name {
+		case "Site":
+			deps.addSiteRef(ident[i+1:])
+			return
+		case "Related", "Prev", "Next":
+			// Pages linking to other pages change along with them
+			deps.Pages = true
+			return
+		}
+	}
+}
+
+func hashFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading file %s: %w", path, err)
+	}
+	return hashBytes(content), nil
+}
+
+func hashBytes(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
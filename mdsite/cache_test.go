@@ -0,0 +1,195 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSiteFiles is a small site with a page using a shortcode and a listing
+// page that shows every page's summary.
+var testSiteFiles = map[string]string{
+	configFileName: "title: Test\nauthor: Tester\nurl: https://example.com\n" +
+		"templates: [templates/*, partials/*, shortcodes/*]\n",
+	"templates/base.html":  `<html>{{ block "main" . }}{{ end }}</html>`,
+	"templates/page.html":  `{{ define "main" }}{{ .Content }}{{ end }}`,
+	"templates/list.html":  `{{ define "main" }}{{ range .Site.Pages }}{{ .Title }}: {{ .Summary }}{{ end }}{{ Include "partials/footer.html" }}{{ end }}`,
+	"partials/footer.html": `<footer>{{ .Site.Author }}</footer>`,
+	"shortcodes/note.html": `<aside>{{ .Inner }}</aside>`,
+	"index.md":             "---\ntitle: Home\ntemplates: [templates/base.html, templates/list.html]\n---\n",
+	"notes/a.md":           "---\ntitle: A\ntemplates: [templates/base.html, templates/page.html]\n---\n{{< note >}}Hi{{< /note >}}\n",
+	"notes/b.md":           "---\ntitle: B\n---\nNo templates\n",
+	"notes/_defaults.yaml": "templates: [templates/base.html, templates/page.html]\n",
+	"data/site.yaml":       "motto: hello\n",
+	"templates/data.html":  `{{ define "main" }}{{ .Site.Data.site.motto }}{{ end }}`,
+	"about.md":             "---\ntitle: About\ntemplates: [templates/base.html, templates/data.html]\n---\n",
+}
+
+// newTestSite writes files as a site in a git repository, since builds read
+// the current commit.
+func newTestSite(t *testing.T, files map[string]string) string {
+	t.Helper()
+	rootDir := writeFiles(t, files)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=Tester", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "commit", "-q", "-m", "Initial commit"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = rootDir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	return rootDir
+}
+
+// renderedPages builds the site and returns the HTML outputs the build wrote,
+// relative to the output directory, by backdating every output beforehand.
+func renderedPages(t *testing.T, rootDir string, opts buildOptions) []string {
+	t.Helper()
+	if opts.jobs == 0 {
+		opts.jobs = 2
+	}
+	outRoot := rootDir
+	if opts.outDir != "" {
+		outRoot = opts.outDir
+	}
+
+	backdated := time.Now().Add(-time.Hour).Truncate(time.Second)
+	outputs := func() map[string]time.Time {
+		files := map[string]time.Time{}
+		filepath.Walk(outRoot, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(filePath) != ".html" {
+				return nil
+			}
+			rel, _ := filepath.Rel(outRoot, filePath)
+			rel = filepath.ToSlash(rel)
+			for _, dir := range []string{"templates/", "partials/", "shortcodes/"} {
+				if strings.HasPrefix(rel, dir) {
+					return nil
+				}
+			}
+			files[rel] = info.ModTime()
+			return nil
+		})
+		return files
+	}
+
+	for rel := range outputs() {
+		if err := os.Chtimes(filepath.Join(outRoot, rel), backdated, backdated); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := build(rootDir, opts); err != nil {
+		t.Fatalf("build: %v", err)
+	}
+
+	rendered := []string{}
+	for rel, modTime := range outputs() {
+		if !modTime.Equal(backdated) {
+			rendered = append(rendered, rel)
+		}
+	}
+	sort.Strings(rendered)
+	return rendered
+}
+
+func TestBuildCacheSkipsUnchangedPages(t *testing.T) {
+	rootDir := newTestSite(t, testSiteFiles)
+
+	all := []string{"about.html", "index.html", "notes/a.html", "notes/b.html"}
+	if got := renderedPages(t, rootDir, buildOptions{}); !reflect.DeepEqual(got, all) {
+		t.Fatalf("first build rendered %v, want %v", got, all)
+	}
+	if got := renderedPages(t, rootDir, buildOptions{}); len(got) != 0 {
+		t.Errorf("second build rendered %v, want nothing", got)
+	}
+	if got := renderedPages(t, rootDir, buildOptions{}); len(got) != 0 {
+		t.Errorf("third build rendered %v, want nothing", got)
+	}
+}
+
+func TestBuildCacheRendersChangedPages(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		text string
+		want []string
+	}{
+		{"template", "templates/page.html", `{{ define "main" }}<main>{{ .Content }}</main>{{ end }}`, []string{"notes/a.html", "notes/b.html"}},
+		{"partial", "partials/footer.html", `<footer>By {{ .Site.Author }}</footer>`, []string{"index.html"}},
+		{"shortcode", "shortcodes/note.html", `<aside class="note">{{ .Inner }}</aside>`, []string{"index.html", "notes/a.html"}},
+		{"data", "data/site.yaml", "motto: goodbye\n", []string{"about.html"}},
+		{"defaults", "notes/_defaults.yaml", "templates: [templates/base.html, templates/page.html]\nsummary: A note\n", []string{"index.html", "notes/a.html", "notes/b.html"}},
+		{"markdown", "notes/b.md", "---\ntitle: B\n---\nChanged\n", []string{"index.html", "notes/b.html"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := newTestSite(t, testSiteFiles)
+			renderedPages(t, rootDir, buildOptions{})
+
+			if err := ioutil.WriteFile(filepath.Join(rootDir, filepath.FromSlash(tt.file)), []byte(tt.text), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if got := renderedPages(t, rootDir, buildOptions{}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("after changing %s rendered %v, want %v", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildCacheForce(t *testing.T) {
+	rootDir := newTestSite(t, testSiteFiles)
+	renderedPages(t, rootDir, buildOptions{})
+
+	all := []string{"about.html", "index.html", "notes/a.html", "notes/b.html"}
+	if got := renderedPages(t, rootDir, buildOptions{force: true}); !reflect.DeepEqual(got, all) {
+		t.Errorf("-force rendered %v, want %v", got, all)
+	}
+}
+
+func TestBuildCacheOutDir(t *testing.T) {
+	rootDir := newTestSite(t, testSiteFiles)
+	outDir := filepath.Join(t.TempDir(), "public")
+	opts := buildOptions{outDir: outDir}
+
+	all := []string{"about.html", "index.html", "notes/a.html", "notes/b.html"}
+	if got := renderedPages(t, rootDir, opts); !reflect.DeepEqual(got, all) {
+		t.Fatalf("first build rendered %v, want %v", got, all)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, manifestFileName)); err != nil {
+		t.Errorf("manifest missing from the output directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, manifestFileName)); !os.IsNotExist(err) {
+		t.Errorf("manifest written to the site root: %v", err)
+	}
+
+	if got := renderedPages(t, rootDir, opts); len(got) != 0 {
+		t.Errorf("second build rendered %v, want nothing", got)
+	}
+}
+
+func TestBuildCacheRendersPagesUsingNow(t *testing.T) {
+	files := map[string]string{}
+	for name, text := range testSiteFiles {
+		files[name] = text
+	}
+	files["templates/data.html"] = `{{ define "main" }}Generated {{ Now.Format "2006-01-02" }}{{ end }}`
+	rootDir := newTestSite(t, files)
+	renderedPages(t, rootDir, buildOptions{})
+
+	for i := 0; i < 2; i++ {
+		if got := renderedPages(t, rootDir, buildOptions{}); !reflect.DeepEqual(got, []string{"about.html"}) {
+			t.Errorf("build %d rendered %v, want [about.html]", i+2, got)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// idAttrPattern matches the attributes that can be the target of a #fragment
+// link.
+var idAttrPattern = regexp.MustCompile(`(?i)\s(?:id|name)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// brokenLink is an internal link or asset reference on a generated page that
+// doesn't resolve to anything in the output tree.
+type brokenLink struct {
+	page   *Page
+	link   string
+	reason string
+}
+
+func (b brokenLink) String() string {
+	return fmt.Sprintf("%s: %s (%s)", b.page.OutputFile, b.link, b.reason)
+}
+
+// linkChecker resolves links against the generated site in outputRoot.
+type linkChecker struct {
+	outputRoot string
+	siteURL    *url.URL
+
+	// Anchor IDs of each HTML file read so far
+	ids map[string]map[string]bool
+}
+
+// checkLinks reads every generated HTML page and returns each href and src
+// pointing into the site that doesn't resolve to a file in outputRoot, or to
+// an anchor missing from its target page.
+func checkLinks(site *Site, outputRoot string) ([]brokenLink, error) {
+	siteURL, err := url.Parse(site.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &linkChecker{
+		outputRoot: outputRoot,
+		siteURL:    siteURL,
+		ids:        map[string]map[string]bool{},
+	}
+
+	broken := []brokenLink{}
+	for _, page := range site.Pages {
+		if filepath.Ext(page.OutputFile) != ".html" {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(page.OutputFile)
+		if err != nil {
+			broken = append(broken, brokenLink{page, page.URL, "page was not generated"})
+			continue
+		}
+
+		seen := map[string]bool{}
+		for _, m := range linkAttrPattern.FindAllStringSubmatch(string(content), -1) {
+			link := m[2] + m[3]
+			if seen[link] {
+				continue
+			}
+			seen[link] = true
+
+			if reason := c.check(page, html.UnescapeString(link)); reason != "" {
+				broken = append(broken, brokenLink{page, link, reason})
+			}
+		}
+	}
+
+	return broken, nil
+}
+
+// check returns why link, found on page, is broken or an empty string if it
+// resolves. Links outside the site are not checked.
+func (c *linkChecker) check(page *Page, link string) string {
+	ref, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "invalid URL"
+	}
+
+	pageURL, err := url.Parse(page.URL)
+	if err != nil {
+		return "invalid page URL"
+	}
+
+	target := pageURL.ResolveReference(ref)
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host != c.siteURL.Host {
+		return ""
+	}
+
+	file, ok := c.resolveFile(target.Path)
+	if !ok {
+		return "not found"
+	}
+
+	if target.Fragment == "" || filepath.Ext(file) != ".html" {
+		return ""
+	}
+
+	ids, err := c.anchorIDs(file)
+	if err != nil {
+		return err.Error()
+	}
+	if !ids[target.Fragment] {
+		return fmt.Sprintf("anchor #%s not found", target.Fragment)
+	}
+	return ""
+}
+
+// resolveFile returns the file a web server would respond with for urlPath,
+// trying index.html for directories and an .html extension for bare names.
+func (c *linkChecker) resolveFile(urlPath string) (string, bool) {
+	base := filepath.Join(c.outputRoot, filepath.FromSlash(path.Clean("/"+urlPath)))
+
+	candidates := []string{base}
+	if strings.HasSuffix(urlPath, "/") || urlPath == "" {
+		candidates = []string{filepath.Join(base, "index.html")}
+	} else {
+		candidates = append(candidates, filepath.Join(base, "index.html"), base+".html")
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+func (c *linkChecker) anchorIDs(file string) (map[string]bool, error) {
+	if ids, ok := c.ids[file]; ok {
+		return ids, nil
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]bool{}
+	for _, m := range idAttrPattern.FindAllStringSubmatch(string(content), -1) {
+		ids[html.UnescapeString(m[1]+m[2])] = true
+	}
+
+	c.ids[file] = ids
+	return ids, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	outputRoot := writeFiles(t, map[string]string{
+		"index.html": `<link rel="stylesheet" href="/style.css">
+<a href="rings/">Rings</a>
+<a href="/rings/#demo">Demo</a>
+<a href="/rings/#missing">Missing anchor</a>
+<a href="yoto/">Broken</a>
+<a href="projects">Projects</a>
+<a href="https://example.com/rings/">Absolute</a>
+<a href="https://github.com/kdeloach">GitHub</a>
+<a href="mailto:me@example.com">Email</a>`,
+		"projects.html":    `<a href="#top" id="top">Top</a>`,
+		"rings/index.html": `<h2 id="demo">Demo</h2><img src="../missing.png"><a href="./#demo">Again</a>`,
+		"style.css":        "",
+	})
+
+	page := func(relPath, pageURL string) *Page {
+		return &Page{OutputFile: filepath.Join(outputRoot, filepath.FromSlash(relPath)), URL: pageURL}
+	}
+	site := &Site{
+		URL: "https://example.com/",
+		Pages: []*Page{
+			page("index.html", "https://example.com/"),
+			page("projects.html", "https://example.com/projects"),
+			page("rings/index.html", "https://example.com/rings/"),
+			page("yoto/index.html", "https://example.com/yoto/"),
+			page("feed.xml", "https://example.com/feed.xml"),
+		},
+	}
+
+	broken, err := checkLinks(site, outputRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, b := range broken {
+		rel, _ := filepath.Rel(outputRoot, b.page.OutputFile)
+		got = append(got, filepath.ToSlash(rel)+": "+b.link+" ("+b.reason+")")
+	}
+	want := []string{
+		"index.html: /rings/#missing (anchor #missing not found)",
+		"index.html: yoto/ (not found)",
+		"rings/index.html: ../missing.png (not found)",
+		"yoto/index.html: https://example.com/yoto/ (page was not generated)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("checkLinks reported\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const configFileName = "site.yaml"
+
+// Config holds site-wide settings loaded from site.yaml at the site root.
+type Config struct {
+	Title       string                 `yaml:"title"`
+	Author      string                 `yaml:"author"`
+	Description string                 `yaml:"description"`
+	URL         string                 `yaml:"url"`
+	PubDate     time.Time              `yaml:"pubDate"`
+	Params      map[string]interface{} `yaml:"params"`
+
+	// Directory, relative to the site root, of YAML, JSON and CSV files
+	// loaded into .Site.Data
+	Data string `yaml:"data"`
+
+	// Static lists path patterns, relative to the site root, of files that
+	// are copied as-is when building into a separate output directory.
+	Static []string `yaml:"static"`
+
+	// Assets lists path patterns of static files that templates link to with
+	// Asset. When building into a separate output directory they're copied
+	// under fingerprinted names, listed in the AssetManifest file.
+	Assets        []string `yaml:"assets"`
+	AssetManifest string   `yaml:"assetManifest"`
+
+	Images ImagesConfig `yaml:"images"`
+
+	// Templates lists path patterns of every template and partial. They're
+	// all parsed on each build so errors surface before any page uses them.
+	Templates []string `yaml:"templates"`
+
+	Taxonomy TaxonomyConfig `yaml:"taxonomy"`
+
+	Feeds []FeedConfig `yaml:"feeds"`
+
+	// Paths, relative to the site root, of the generated sitemap and
+	// robots.txt. Neither is written when Sitemap is empty.
+	Sitemap string `yaml:"sitemap"`
+	Robots  string `yaml:"robots"`
+
+	// Frontmatter values for the pages matching each rule, overridden by
+	// _defaults.yaml files and the pages themselves
+	Defaults []DefaultsRule `yaml:"defaults"`
+
+	// Frontmatter keys that pages with each tag must set, checked with -strict
+	Required map[string][]string `yaml:"required"`
+
+	// What to do with markdown files that have no frontmatter: "skip" them
+	// quietly, "warn" about them, or fail the build with "error"
+	NoFrontmatter string `yaml:"noFrontmatter"`
+}
+
+// TaxonomyConfig controls the generated tag pages. No pages are generated
+// unless Templates is set.
+type TaxonomyConfig struct {
+	// Directory, relative to the site root, the tag pages are written to
+	Path string `yaml:"path"`
+	// Templates for each tag's page
+	Templates []string `yaml:"templates"`
+	// Templates for the overview page listing every tag
+	IndexTemplates []string `yaml:"indexTemplates"`
+	// Title of the overview page
+	IndexTitle string `yaml:"indexTitle"`
+}
+
+// ImagesConfig controls the resized copies of images made for ImageSet.
+type ImagesConfig struct {
+	// Directory, relative to the site root, resized copies are written to
+	Path string `yaml:"path"`
+	// Widths in pixels to resize each image to. Widths at least as wide as
+	// an image are skipped.
+	Widths []int `yaml:"widths"`
+}
+
+// FeedConfig lists the feeds generated for the pages with a tag. Each format
+// is written to its path, relative to the site root, when one is set.
+type FeedConfig struct {
+	Tag   string `yaml:"tag"`
+	Title string `yaml:"title"`
+	RSS   string `yaml:"rss"`
+	Atom  string `yaml:"atom"`
+	JSON  string `yaml:"json"`
+	// Maximum number of items, newest first. Zero means no limit.
+	Limit int `yaml:"limit"`
+	// Include each page's rendered content, not just its summary
+	FullContent bool `yaml:"fullContent"`
+}
+
+func loadConfig(rootDir string) (*Config, error) {
+	path := filepath.Join(rootDir, configFileName)
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading site config %s: %w", path, err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("Error parsing site config %s: %w", path, err)
+	}
+
+	required := []struct {
+		key   string
+		value string
+	}{
+		{"title", config.Title},
+		{"author", config.Author},
+		{"url", config.URL},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			return nil, fmt.Errorf("Missing required key %q in site config %s", r.key, path)
+		}
+	}
+
+	siteURL, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing url in site config %s: %w", path, err)
+	}
+	if !siteURL.IsAbs() {
+		return nil, fmt.Errorf("url %q in site config %s must be absolute", config.URL, path)
+	}
+
+	if config.Data == "" {
+		config.Data = "data"
+	}
+
+	if config.AssetManifest == "" {
+		config.AssetManifest = "assets.json"
+	}
+
+	if config.Images.Path == "" {
+		config.Images.Path = "images/resized"
+	}
+
+	if config.Taxonomy.Path == "" {
+		config.Taxonomy.Path = "tags"
+	}
+	if config.Taxonomy.IndexTitle == "" {
+		config.Taxonomy.IndexTitle = "Tags"
+	}
+
+	for i, feed := range config.Feeds {
+		if feed.Tag == "" {
+			return nil, fmt.Errorf("Missing required key \"tag\" in feeds[%d] in site config %s", i, path)
+		}
+	}
+
+	switch config.NoFrontmatter {
+	case "":
+		config.NoFrontmatter = "skip"
+	case "skip", "warn", "error":
+	default:
+		return nil, fmt.Errorf("noFrontmatter %q in site config %s must be one of skip, warn or error", config.NoFrontmatter, path)
+	}
+
+	if config.Params == nil {
+		config.Params = map[string]interface{}{}
+	}
+
+	return &config, nil
+}
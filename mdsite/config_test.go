@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	const valid = "title: Test\nauthor: Tester\nurl: https://example.com/\n"
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+		check   func(*Config) bool
+	}{
+		{"missing title", "author: Tester\nurl: https://example.com/\n", `Missing required key "title"`, nil},
+		{"missing author", "title: Test\nurl: https://example.com/\n", `Missing required key "author"`, nil},
+		{"missing url", "title: Test\nauthor: Tester\n", `Missing required key "url"`, nil},
+		{"relative url", "title: Test\nauthor: Tester\nurl: example.com\n", `url "example.com" in site config`, nil},
+		{"path url", "title: Test\nauthor: Tester\nurl: /blog/\n", "must be absolute", nil},
+		{"feed without tag", valid + "feeds:\n  - rss: rss.xml\n", `Missing required key "tag" in feeds[0]`, nil},
+		{"bad noFrontmatter", valid + "noFrontmatter: ignore\n", `noFrontmatter "ignore"`, nil},
+		{"bad yaml", valid + "title: [\n", "Error parsing site config", nil},
+		{"defaults", valid, "", func(c *Config) bool {
+			return c.Data == "data" && c.AssetManifest == "assets.json" && c.NoFrontmatter == "skip" &&
+				c.Images.Path == "images/resized" && c.Taxonomy.Path == "tags" && c.Taxonomy.IndexTitle == "Tags" &&
+				c.Params != nil
+		}},
+		{"overridden defaults", valid + "data: content/data\nassetManifest: manifest.json\nnoFrontmatter: error\n", "", func(c *Config) bool {
+			return c.Data == "content/data" && c.AssetManifest == "manifest.json" && c.NoFrontmatter == "error"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := writeFiles(t, map[string]string{configFileName: tt.config})
+			config, err := loadConfig(rootDir)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfig error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(config) {
+				t.Errorf("loadConfig = %+v", config)
+			}
+		})
+	}
+
+	if _, err := loadConfig(t.TempDir()); err == nil || !strings.Contains(err.Error(), "Error reading site config") {
+		t.Errorf("loadConfig without %s error = %v", configFileName, err)
+	}
+}
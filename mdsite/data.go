@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// loadData reads every YAML, JSON and CSV file under dataDir into nested maps
+// keyed by directory and file name without extension, so data/jobs.yaml is
+// available to templates as .Site.Data.jobs. It also returns a hash of the
+// files read.
+func loadData(dataDir string) (map[string]interface{}, string, error) {
+	data := map[string]interface{}{}
+	h := sha256.New()
+
+	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
+		return data, "", nil
+	}
+
+	err := filepath.Walk(dataDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("Error accessing file %s: %w", filePath, err)
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(filePath))
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" && ext != ".csv" {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("Error reading data file %s: %w", filePath, err)
+		}
+		fmt.Fprintf(h, "data %s %s\n", filePath, hashBytes(content))
+
+		value, err := decodeDataFile(ext, content)
+		if err != nil {
+			return fmt.Errorf("Error parsing data file %s: %w", filePath, err)
+		}
+
+		relPath, err := filepath.Rel(dataDir, filePath)
+		if err != nil {
+			return err
+		}
+		keys := strings.Split(filepath.ToSlash(strings.TrimSuffix(relPath, filepath.Ext(relPath))), "/")
+
+		parent := data
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := parent[key].(map[string]interface{})
+			if !ok {
+				if _, exists := parent[key]; exists {
+					return fmt.Errorf("Data directory %s conflicts with a data file of the same name", filepath.Join(dataDir, key))
+				}
+				child = map[string]interface{}{}
+				parent[key] = child
+			}
+			parent = child
+		}
+
+		last := keys[len(keys)-1]
+		if _, exists := parent[last]; exists {
+			return fmt.Errorf("Data file %s conflicts with another file or directory of the same name", filePath)
+		}
+		parent[last] = value
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func decodeDataFile(ext string, content []byte) (interface{}, error) {
+	switch ext {
+	case ".csv":
+		return decodeCSV(content)
+	case ".json":
+		var value interface{}
+		if err := json.Unmarshal(content, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	default:
+		var value interface{}
+		if err := yaml.Unmarshal(content, &value); err != nil {
+			return nil, err
+		}
+		return normalizeYAML(value), nil
+	}
+}
+
+// decodeCSV returns one map per row, keyed by the names in the header row.
+func decodeCSV(content []byte) ([]map[string]string, error) {
+	records, err := csv.NewReader(strings.NewReader(string(content))).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []map[string]string{}
+	if len(records) == 0 {
+		return rows, nil
+	}
+
+	header := records[0]
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, name := range header {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// normalizeYAML converts the map[interface{}]interface{} values yaml.v2
+// produces to map[string]interface{}, so data from every format looks the
+// same to templates and can be encoded as JSON.
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = normalizeYAML(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = normalizeYAML(val)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadData(t *testing.T) {
+	dataDir := writeFiles(t, map[string]string{
+		"jobs.yaml":        "- company: Acme\n  details: [one, two]\n",
+		"books/2021.csv":   "title,author\nDune,Herbert\n",
+		"books/stats.json": `{"count": 1}`,
+		"notes.txt":        "ignored",
+	})
+
+	data, hash, err := loadData(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "" {
+		t.Errorf("loadData returned no hash")
+	}
+
+	want := map[string]interface{}{
+		"jobs": []interface{}{
+			map[string]interface{}{"company": "Acme", "details": []interface{}{"one", "two"}},
+		},
+		"books": map[string]interface{}{
+			"2021":  []map[string]string{{"title": "Dune", "author": "Herbert"}},
+			"stats": map[string]interface{}{"count": float64(1)},
+		},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("loadData = %#v, want %#v", data, want)
+	}
+}
+
+func TestLoadDataConflict(t *testing.T) {
+	dataDir := writeFiles(t, map[string]string{
+		"books.yaml":     "[]",
+		"books/2021.csv": "title\nDune\n",
+	})
+
+	if _, _, err := loadData(dataDir); err == nil {
+		t.Errorf("loadData with books.yaml and a books directory returned no error")
+	}
+}
+
+func TestLoadDataMissingDir(t *testing.T) {
+	data, _, err := loadData(filepath.Join(os.TempDir(), "no-such-data-dir"))
+	if err != nil || len(data) != 0 {
+		t.Errorf("loadData of a missing directory = %v, %v, want empty", data, err)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// defaultsFileName is the file in a directory holding frontmatter defaults
+// for every page in it and its subdirectories.
+const defaultsFileName = "_defaults.yaml"
+
+// DefaultsRule supplies frontmatter values to the pages matching a pattern.
+type DefaultsRule struct {
+	// Path pattern of markdown files, relative to the site root, such as
+	// "*/index.md"
+	Path   string                 `yaml:"path"`
+	Values map[string]interface{} `yaml:"values"`
+}
+
+// frontmatterDefaults finds the default frontmatter values of each page. Keys
+// set by a defaults file override those from rules in site.yaml, files in
+// deeper directories override those above them, and the page's own
+// frontmatter overrides them all.
+type frontmatterDefaults struct {
+	rootDir string
+	rules   []DefaultsRule
+	strict  bool
+	// Values from the defaults file in each directory, nil when it has none
+	dirs map[string]map[string]interface{}
+}
+
+// newFrontmatterDefaults checks that the values of every rule are valid
+// frontmatter. In strict mode unknown keys are rejected.
+func newFrontmatterDefaults(rootDir string, rules []DefaultsRule, strict bool) (*frontmatterDefaults, error) {
+	for i, rule := range rules {
+		if rule.Path == "" {
+			return nil, fmt.Errorf("Missing required key \"path\" in defaults[%d] in site config", i)
+		}
+		if _, err := path.Match(rule.Path, ""); err != nil {
+			return nil, fmt.Errorf("Invalid path %q in defaults[%d] in site config: %w", rule.Path, i, err)
+		}
+		content, err := yaml.Marshal(rule.Values)
+		if err != nil {
+			return nil, err
+		}
+		var scratch Frontmatter
+		if errs := unmarshalFrontmatter(configFileName, string(content), 0, strict, &scratch); len(errs) > 0 {
+			return nil, fmt.Errorf("Invalid values in defaults[%d] in site config: %s", i, errs[0].(*frontmatterError).msg)
+		}
+	}
+
+	return &frontmatterDefaults{
+		rootDir: rootDir,
+		rules:   rules,
+		strict:  strict,
+		dirs:    map[string]map[string]interface{}{},
+	}, nil
+}
+
+// apply decodes the defaults for the markdown file at filePath into
+// frontmatter, ahead of the page's own values. It returns the default values
+// and their encoding, which the build cache treats as part of the page's
+// source.
+func (d *frontmatterDefaults) apply(filePath string, frontmatter *Frontmatter) (map[string]interface{}, []byte, error) {
+	relPath, err := filepath.Rel(d.rootDir, filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	values := map[string]interface{}{}
+	for _, rule := range d.rules {
+		if ok, _ := path.Match(rule.Path, relPath); ok {
+			mergeValues(values, rule.Values)
+		}
+	}
+
+	// Directories from the site root down to the page's own
+	dirs := []string{d.rootDir}
+	if dir := path.Dir(relPath); dir != "." {
+		for _, name := range strings.Split(dir, "/") {
+			dirs = append(dirs, filepath.Join(dirs[len(dirs)-1], name))
+		}
+	}
+	for _, dir := range dirs {
+		dirValues, err := d.load(dir)
+		if err != nil {
+			return nil, nil, err
+		}
+		mergeValues(values, dirValues)
+	}
+
+	if len(values) == 0 {
+		return values, nil, nil
+	}
+
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := yaml.Unmarshal(content, frontmatter); err != nil {
+		return nil, nil, fmt.Errorf("Error applying frontmatter defaults to %s: %w", filePath, err)
+	}
+	return values, content, nil
+}
+
+// load returns the values of the defaults file in dir, reading it the first
+// time it's needed.
+func (d *frontmatterDefaults) load(dir string) (map[string]interface{}, error) {
+	if values, ok := d.dirs[dir]; ok {
+		return values, nil
+	}
+
+	filePath := filepath.Join(dir, defaultsFileName)
+	content, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		d.dirs[dir] = nil
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading frontmatter defaults %s: %w", filePath, err)
+	}
+
+	var scratch Frontmatter
+	if errs := unmarshalFrontmatter(filePath, string(content), 0, d.strict, &scratch); len(errs) > 0 {
+		return nil, fmt.Errorf("Error parsing frontmatter defaults: %w", errs[0])
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("Error parsing frontmatter defaults %s: %w", filePath, err)
+	}
+	values := map[string]interface{}{}
+	for key, value := range raw {
+		values[key] = normalizeYAML(value)
+	}
+
+	d.dirs[dir] = values
+	return values, nil
+}
+
+// mergeValues sets every key of src in dst, replacing values already there.
+func mergeValues(dst, src map[string]interface{}) {
+	for key, value := range src {
+		dst[key] = value
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFrontmatterDefaults(t *testing.T) {
+	rootDir := writeFiles(t, map[string]string{
+		"_defaults.yaml":              "templates: [templates/base.html, templates/page.html]\ntoc: true\n",
+		"archive/_defaults.yaml":      "summary: From the archive\n",
+		"archive/2020/_defaults.yaml": "tags: [books]\n",
+	})
+
+	rules := []DefaultsRule{
+		{Path: "*/index.md", Values: map[string]interface{}{"tags": []string{"post"}, "toc": false}},
+		{Path: "archive/2020/*.md", Values: map[string]interface{}{"image": "/books.png"}},
+	}
+	defaults, err := newFrontmatterDefaults(rootDir, rules, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decode := func(relPath, text string) (*Frontmatter, map[string]interface{}) {
+		t.Helper()
+		var fm Frontmatter
+		values, _, err := defaults.apply(filepath.Join(rootDir, filepath.FromSlash(relPath)), &fm)
+		if err != nil {
+			t.Fatalf("apply(%s): %v", relPath, err)
+		}
+		raw, err := splitFrontmatter(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := decodeFrontmatter(relPath, raw, true, &fm); len(errs) > 0 {
+			t.Fatalf("decodeFrontmatter(%s): %v", relPath, errs)
+		}
+		return &fm, values
+	}
+
+	// Rules apply first, then defaults files from the root down
+	fm, values := decode("rings/index.md", "---\ntitle: Rings\n---\n")
+	if fm.Title != "Rings" || !reflect.DeepEqual(fm.Tags, []string{"post"}) || !fm.ShowTOC || len(fm.Templates) != 2 {
+		t.Errorf("rings/index.md = %+v", fm)
+	}
+	if values["toc"] != true {
+		t.Errorf("values[toc] = %v, want true", values["toc"])
+	}
+
+	fm, _ = decode("archive/2020/books.md", "---\ntitle: Books\nsummary: Mine\n---\n")
+	if fm.Summary != "Mine" || fm.Image != "/books.png" || !reflect.DeepEqual(fm.Tags, []string{"books"}) {
+		t.Errorf("archive/2020/books.md = %+v", fm)
+	}
+
+	fm, _ = decode("archive/hello.md", "+++\ntags = []\n+++\n")
+	if fm.Summary != "From the archive" || len(fm.Tags) != 0 {
+		t.Errorf("archive/hello.md = %+v", fm)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(rootDir, "archive", "_defaults.yaml"), []byte("summary: x\nbogus: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	strict, _ := newFrontmatterDefaults(rootDir, nil, true)
+	var fm2 Frontmatter
+	if _, _, err := strict.apply(filepath.Join(rootDir, "archive", "a.md"), &fm2); err == nil || !strings.Contains(err.Error(), "_defaults.yaml:2") {
+		t.Errorf("apply with an unknown key = %v, want an error at _defaults.yaml:2", err)
+	}
+
+	if _, err := newFrontmatterDefaults(rootDir, []DefaultsRule{{Path: "*.md", Values: map[string]interface{}{"date": "soon"}}}, false); err == nil {
+		t.Error("newFrontmatterDefaults accepted an invalid date")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+const (
+	// moreMarker ends the excerpt when placed in a page's markdown
+	moreMarker = "<!--more-->"
+
+	wordsPerMinute = 200
+)
+
+var (
+	scriptPattern = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>`)
+	tagPattern    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// Summary returns the summary from the frontmatter. When that's empty it
+// falls back to the content before a <!--more--> marker, or else the first
+// paragraph, as plain text.
+func (p *Page) Summary() string {
+	if p.Frontmatter.Summary != "" {
+		return p.Frontmatter.Summary
+	}
+
+	p.parse()
+	if i := strings.Index(p.content, moreMarker); i >= 0 {
+		return plainText(p.content[:i])
+	}
+	return plainText(p.firstParagraph)
+}
+
+// WordCount returns the number of words in the page's rendered content.
+func (p *Page) WordCount() int {
+	p.parse()
+	return p.wordCount
+}
+
+// ReadingTime returns the estimated minutes needed to read the page.
+func (p *Page) ReadingTime() int {
+	words := p.WordCount()
+	if words == 0 {
+		return 0
+	}
+	return (words + wordsPerMinute - 1) / wordsPerMinute
+}
+
+// plainText strips tags, scripts and styles from rendered HTML and collapses
+// whitespace.
+func plainText(content string) string {
+	content = scriptPattern.ReplaceAllString(content, "")
+	content = tagPattern.ReplaceAllString(content, "")
+	return strings.Join(strings.Fields(html.UnescapeString(content)), " ")
+}
+
+// firstParagraph returns the first paragraph of a parsed markdown document.
+func firstParagraph(doc ast.Node) ast.Node {
+	var para ast.Node
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if _, ok := node.(*ast.Paragraph); ok && entering {
+			para = node
+			return ast.Terminate
+		}
+		return ast.GoToNext
+	})
+	return para
+}
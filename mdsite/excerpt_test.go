@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name     string
+		summary  string
+		markdown string
+		want     string
+	}{
+		{
+			name:     "frontmatter",
+			summary:  "From frontmatter.",
+			markdown: "First paragraph.",
+			want:     "From frontmatter.",
+		},
+		{
+			name:     "first paragraph",
+			markdown: "## Intro\n\nSome **bold** text &amp; a [link](/x).\n\nSecond paragraph.",
+			want:     "Some bold text & a link.",
+		},
+		{
+			name:     "more marker",
+			markdown: "One.\n\nTwo.\n\n<!--more-->\n\nThree.",
+			want:     "One. Two.",
+		},
+	}
+
+	for _, tt := range tests {
+		page := &Page{Frontmatter: &Frontmatter{Summary: tt.summary}, Markdown: tt.markdown}
+		if got := page.Summary(); got != tt.want {
+			t.Errorf("%s: Summary() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	tests := map[int]int{0: 0, 1: 1, 200: 1, 201: 2, 1000: 5}
+	for words, want := range tests {
+		page := &Page{Frontmatter: &Frontmatter{}}
+		page.parseOnce.Do(func() {})
+		page.wordCount = words
+		if got := page.ReadingTime(); got != want {
+			t.Errorf("ReadingTime() with %d words = %d, want %d", words, got, want)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Feed describes the generated feeds for one tag. Templates use it to link
+// to them.
+type Feed struct {
+	Tag     string
+	Title   string
+	RSSURL  string
+	AtomURL string
+	JSONURL string
+
+	config FeedConfig
+}
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	DCNS      string     `xml:"xmlns:dc,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language,omitempty"`
+	PubDate       string    `xml:"pubDate,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	Description string        `xml:"description,omitempty"`
+	Content     *rssContent   `xml:"content:encoded"`
+	Creator     string        `xml:"dc:creator,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssContent struct {
+	Body string `xml:",cdata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Author   atomPerson  `xml:"author"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published,omitempty"`
+	Updated   string     `xml:"updated"`
+	Author    atomPerson `xml:"author"`
+	Summary   *atomText  `xml:"summary"`
+	Content   *atomText  `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type jsonFeed struct {
+	Version     string       `json:"version"`
+	Title       string       `json:"title"`
+	HomePageURL string       `json:"home_page_url"`
+	FeedURL     string       `json:"feed_url"`
+	Description string       `json:"description,omitempty"`
+	Language    string       `json:"language,omitempty"`
+	Authors     []jsonAuthor `json:"authors"`
+	Items       []jsonItem   `json:"items"`
+}
+
+type jsonItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url"`
+	Title         string       `json:"title"`
+	Summary       string       `json:"summary,omitempty"`
+	ContentText   string       `json:"content_text,omitempty"`
+	ContentHTML   string       `json:"content_html,omitempty"`
+	Image         string       `json:"image,omitempty"`
+	DatePublished string       `json:"date_published,omitempty"`
+	DateModified  string       `json:"date_modified,omitempty"`
+	Authors       []jsonAuthor `json:"authors"`
+	Tags          []string     `json:"tags,omitempty"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+// feedItem holds what every feed format needs to know about a page.
+type feedItem struct {
+	page      *Page
+	image     string
+	imageSize int64
+	imageType string
+	published time.Time
+	updated   time.Time
+	// Rendered page content with absolute links, when the feed includes it
+	content string
+}
+
+// configureFeeds sets up site.Feeds from the feed settings in site.yaml.
+func configureFeeds(site *Site, configs []FeedConfig, locatePage func(string) (string, string)) {
+	for _, config := range configs {
+		feed := &Feed{
+			Tag:    config.Tag,
+			Title:  config.Title,
+			config: config,
+		}
+		if feed.Title == "" {
+			feed.Title = site.Title
+		}
+		if config.RSS != "" {
+			_, feed.RSSURL = locatePage(config.RSS)
+		}
+		if config.Atom != "" {
+			_, feed.AtomURL = locatePage(config.Atom)
+		}
+		if config.JSON != "" {
+			_, feed.JSONURL = locatePage(config.JSON)
+		}
+		site.Feeds = append(site.Feeds, feed)
+	}
+}
+
+// writeFeeds writes every format configured for each of site.Feeds.
+func writeFeeds(site *Site, rootDir string, locatePage func(string) (string, string)) error {
+	for _, feed := range site.Feeds {
+		items := feedItems(site, rootDir, feed)
+
+		outputs := []struct {
+			relPath string
+			encode  func(*Feed, []feedItem) ([]byte, error)
+		}{
+			{feed.config.RSS, site.encodeRSS},
+			{feed.config.Atom, site.encodeAtom},
+			{feed.config.JSON, site.encodeJSONFeed},
+		}
+
+		for _, output := range outputs {
+			if output.relPath == "" {
+				continue
+			}
+
+			content, err := output.encode(feed, items)
+			if err != nil {
+				return fmt.Errorf("Error encoding feed %s: %w", output.relPath, err)
+			}
+
+			outputPath, _ := locatePage(output.relPath)
+			if err := writeOutput(outputPath, content); err != nil {
+				return err
+			}
+
+			fmt.Printf("Wrote feed %s\n", outputPath)
+		}
+	}
+	return nil
+}
+
+func feedItems(site *Site, rootDir string, feed *Feed) []feedItem {
+	pages := site.PagesByTag[feed.Tag]
+	if feed.config.Limit > 0 && len(pages) > feed.config.Limit {
+		pages = pages[:feed.config.Limit]
+	}
+
+	items := []feedItem{}
+	for _, page := range pages {
+		item := feedItem{
+			page:      page,
+			published: page.Date,
+			updated:   page.Date,
+		}
+		if !page.Updated.IsZero() {
+			item.updated = page.Updated
+		}
+
+		if feed.config.FullContent {
+			item.content = absolutizeLinks(page.Content(), page.URL)
+		}
+
+		if page.Image != "" {
+			item.image = absoluteURL(page.URL, page.Image)
+			item.imageType = mime.TypeByExtension(path.Ext(page.Image))
+			if info, err := os.Stat(localPath(rootDir, page, page.Image)); err == nil {
+				item.imageSize = info.Size()
+			}
+		}
+
+		items = append(items, item)
+	}
+	return items
+}
+
+func (s *Site) encodeRSS(feed *Feed, items []feedItem) ([]byte, error) {
+	channel := rssChannel{
+		Title:         feed.Title,
+		Link:          s.URL,
+		Description:   s.Description,
+		Language:      "en-us",
+		LastBuildDate: s.LastBuild.Format(time.RFC1123Z),
+		Self:          atomLink{Href: feed.RSSURL, Rel: "self", Type: "application/rss+xml"},
+		Items:         []rssItem{},
+	}
+	if !s.PubDate.IsZero() {
+		channel.PubDate = s.PubDate.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, item := range items {
+		rss := rssItem{
+			Title:       item.page.Title,
+			Link:        item.page.URL,
+			Description: item.page.Summary(),
+			Creator:     s.Author,
+			GUID:        rssGUID{IsPermaLink: true, Value: item.page.URL},
+		}
+		if !item.published.IsZero() {
+			rss.PubDate = item.published.UTC().Format(time.RFC1123Z)
+		}
+		if item.content != "" {
+			rss.Content = &rssContent{Body: item.content}
+		}
+		if item.image != "" {
+			rss.Enclosure = &rssEnclosure{URL: item.image, Length: item.imageSize, Type: item.imageType}
+		}
+		channel.Items = append(channel.Items, rss)
+	}
+
+	return encodeXML(rssFeed{
+		Version:   "2.0",
+		AtomNS:    "http://www.w3.org/2005/Atom",
+		DCNS:      "http://purl.org/dc/elements/1.1/",
+		ContentNS: "http://purl.org/rss/1.0/modules/content/",
+		Channel:   channel,
+	})
+}
+
+func (s *Site) encodeAtom(feed *Feed, items []feedItem) ([]byte, error) {
+	atom := atomFeed{
+		Title:    feed.Title,
+		Subtitle: s.Description,
+		ID:       feed.AtomURL,
+		Updated:  s.LastBuild.Format(time.RFC3339),
+		Author:   atomPerson{Name: s.Author},
+		Links: []atomLink{
+			{Href: feed.AtomURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: s.URL, Rel: "alternate", Type: "text/html"},
+		},
+		Entries: []atomEntry{},
+	}
+
+	// The feed was last updated when its newest entry was
+	var latest time.Time
+	for _, item := range items {
+		if item.updated.After(latest) {
+			latest = item.updated
+		}
+	}
+	if !latest.IsZero() {
+		atom.Updated = latest.UTC().Format(time.RFC3339)
+	}
+
+	for _, item := range items {
+		entry := atomEntry{
+			Title:   item.page.Title,
+			ID:      item.page.URL,
+			Links:   []atomLink{{Href: item.page.URL, Rel: "alternate", Type: "text/html"}},
+			Updated: atom.Updated,
+			Author:  atomPerson{Name: s.Author},
+		}
+		if !item.published.IsZero() {
+			entry.Published = item.published.UTC().Format(time.RFC3339)
+		}
+		if !item.updated.IsZero() {
+			entry.Updated = item.updated.UTC().Format(time.RFC3339)
+		}
+		if item.page.Summary() != "" {
+			entry.Summary = &atomText{Type: "text", Body: item.page.Summary()}
+		}
+		if item.content != "" {
+			entry.Content = &atomText{Type: "html", Body: item.content}
+		}
+		if item.image != "" {
+			entry.Links = append(entry.Links, atomLink{Href: item.image, Rel: "enclosure", Type: item.imageType, Length: item.imageSize})
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+
+	return encodeXML(atom)
+}
+
+func (s *Site) encodeJSONFeed(feed *Feed, items []feedItem) ([]byte, error) {
+	authors := []jsonAuthor{{Name: s.Author}}
+
+	jf := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: s.URL,
+		FeedURL:     feed.JSONURL,
+		Description: s.Description,
+		Language:    "en-US",
+		Authors:     authors,
+		Items:       []jsonItem{},
+	}
+
+	for _, item := range items {
+		ji := jsonItem{
+			ID:          item.page.URL,
+			URL:         item.page.URL,
+			Title:       item.page.Title,
+			Summary:     item.page.Summary(),
+			ContentHTML: item.content,
+			Image:       item.image,
+			Authors:     authors,
+			Tags:        item.page.Tags,
+		}
+		if ji.ContentHTML == "" {
+			ji.ContentText = item.page.Summary()
+		}
+		if !item.published.IsZero() {
+			ji.DatePublished = item.published.Format(time.RFC3339)
+		}
+		if !item.updated.IsZero() {
+			ji.DateModified = item.updated.Format(time.RFC3339)
+		}
+		jf.Items = append(jf.Items, ji)
+	}
+
+	content, err := json.MarshalIndent(jf, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+func encodeXML(v interface{}) ([]byte, error) {
+	content, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []byte(xml.Header + string(content) + "\n"), nil
+}
+
+// absoluteURL resolves ref, which may be relative, against base.
+func absoluteURL(base, ref string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
+
+// linkAttrPattern matches src and href attributes along with their quoted
+// value.
+var linkAttrPattern = regexp.MustCompile(`(?i)(\s(?:src|href)\s*=\s*)(?:"([^"]*)"|'([^']*)')`)
+
+// absolutizeLinks rewrites every src and href attribute in content to an
+// absolute URL, resolving relative values against pageURL, so images and
+// links keep working when the content is shown outside the site.
+func absolutizeLinks(content, pageURL string) string {
+	return linkAttrPattern.ReplaceAllStringFunc(content, func(attr string) string {
+		m := linkAttrPattern.FindStringSubmatchIndex(attr)
+		prefix := attr[m[2]:m[3]]
+
+		// Either the double or the single quoted group matched
+		value := ""
+		if m[4] >= 0 {
+			value = attr[m[4]:m[5]]
+		} else {
+			value = attr[m[6]:m[7]]
+		}
+
+		resolved := absoluteURL(pageURL, html.UnescapeString(value))
+		return prefix + `"` + html.EscapeString(resolved) + `"`
+	})
+}
+
+// localPath returns the file in the source tree that ref, a link found on
+// page, points to. Paths starting with a slash are relative to the site root.
+func localPath(rootDir string, page *Page, ref string) string {
+	if strings.HasPrefix(ref, "/") {
+		return filepath.Join(rootDir, filepath.FromSlash(ref))
+	}
+	return filepath.Join(page.Dir, filepath.FromSlash(ref))
+}
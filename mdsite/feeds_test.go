@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAbsolutizeLinks(t *testing.T) {
+	pageURL := "https://example.com/exapunks/"
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			`<img src="preview.png" alt="Preview">`,
+			`<img src="https://example.com/exapunks/preview.png" alt="Preview">`,
+		},
+		{
+			`<a href="/yoto/">Yoto</a>`,
+			`<a href="https://example.com/yoto/">Yoto</a>`,
+		},
+		{
+			`<a href='../rings/#demo'>Rings</a>`,
+			`<a href="https://example.com/rings/#demo">Rings</a>`,
+		},
+		{
+			`<a href="#operands">Operands</a>`,
+			`<a href="https://example.com/exapunks/#operands">Operands</a>`,
+		},
+		{
+			`<a href="https://github.com/kdeloach">GitHub</a> <a href="mailto:me@example.com">Email</a>`,
+			`<a href="https://github.com/kdeloach">GitHub</a> <a href="mailto:me@example.com">Email</a>`,
+		},
+		{
+			`<a href="search?q=a&amp;page=2">Search</a>`,
+			`<a href="https://example.com/exapunks/search?q=a&amp;page=2">Search</a>`,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := absolutizeLinks(tt.input, pageURL); got != tt.want {
+			t.Errorf("absolutizeLinks(%q)\n got %q\nwant %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWriteFeeds(t *testing.T) {
+	rootDir := writeFiles(t, map[string]string{"rings/preview.png": "png bytes"})
+	outDir := t.TempDir()
+	locatePage := func(relPath string) (string, string) {
+		return filepath.Join(outDir, filepath.FromSlash(relPath)), "https://example.com/" + relPath
+	}
+
+	published := time.Date(2023, 11, 10, 0, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+	updated := time.Date(2024, 1, 29, 9, 30, 0, 0, time.UTC)
+	title := `Rings & <knots> ]]>`
+	summary := `Slicing < six-pack & rings ]]>`
+	page := &Page{
+		Path: filepath.Join(rootDir, "rings", "index.md"),
+		Dir:  filepath.Join(rootDir, "rings"),
+		URL:  "https://example.com/rings/",
+		Frontmatter: &Frontmatter{
+			Title:   title,
+			Summary: summary,
+			Date:    published,
+			Updated: updated,
+			Image:   "preview.png",
+			Tags:    []string{"post"},
+		},
+		Markdown: "<div>Ends a CDATA section: ]]></div>\n\n![Preview](preview.png)\n",
+	}
+	site := &Site{
+		Title:      "Test",
+		Author:     "Tester",
+		URL:        "https://example.com/",
+		LastBuild:  updated.Add(time.Hour),
+		PagesByTag: map[string][]*Page{"post": {page}},
+	}
+	configureFeeds(site, []FeedConfig{{Tag: "post", RSS: "rss.xml", Atom: "atom.xml", JSON: "feed.json", FullContent: true}}, locatePage)
+	if err := writeFeeds(site, rootDir, locatePage); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) []byte {
+		t.Helper()
+		content, err := ioutil.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+	const imageURL = "https://example.com/rings/preview.png"
+
+	var rss struct {
+		Channel struct {
+			Items []struct {
+				Title       string `xml:"title"`
+				Link        string `xml:"link"`
+				Description string `xml:"description"`
+				Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+				GUID        struct {
+					IsPermaLink string `xml:"isPermaLink,attr"`
+					Value       string `xml:",chardata"`
+				} `xml:"guid"`
+				PubDate   string `xml:"pubDate"`
+				Enclosure struct {
+					URL    string `xml:"url,attr"`
+					Length int64  `xml:"length,attr"`
+					Type   string `xml:"type,attr"`
+				} `xml:"enclosure"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(read("rss.xml"), &rss); err != nil {
+		t.Fatalf("rss.xml isn't well-formed: %v", err)
+	}
+	if len(rss.Channel.Items) != 1 {
+		t.Fatalf("rss.xml has %d items, want 1", len(rss.Channel.Items))
+	}
+	item := rss.Channel.Items[0]
+	if item.Title != title || item.Description != summary || item.Link != page.URL {
+		t.Errorf("rss item = %q %q %q", item.Title, item.Description, item.Link)
+	}
+	if item.GUID.Value != page.URL || item.GUID.IsPermaLink != "true" {
+		t.Errorf("rss guid = %+v, want permalink %s", item.GUID, page.URL)
+	}
+	if item.PubDate != "Fri, 10 Nov 2023 05:00:00 +0000" {
+		t.Errorf("rss pubDate = %q", item.PubDate)
+	}
+	if !strings.Contains(item.Content, "]]>") || !strings.Contains(item.Content, `src="`+imageURL+`"`) {
+		t.Errorf("rss content = %q, want the CDATA end and an absolute image", item.Content)
+	}
+	if item.Enclosure.URL != imageURL || item.Enclosure.Length != int64(len("png bytes")) || item.Enclosure.Type != "image/png" {
+		t.Errorf("rss enclosure = %+v", item.Enclosure)
+	}
+
+	var atom atomFeed
+	if err := xml.Unmarshal(read("atom.xml"), &atom); err != nil {
+		t.Fatalf("atom.xml isn't well-formed: %v", err)
+	}
+	if atom.Updated != "2024-01-29T09:30:00Z" || len(atom.Entries) != 1 {
+		t.Fatalf("atom feed updated %q with %d entries", atom.Updated, len(atom.Entries))
+	}
+	entry := atom.Entries[0]
+	if entry.Title != title || entry.ID != page.URL || entry.Summary == nil || entry.Summary.Body != summary {
+		t.Errorf("atom entry = %+v", entry)
+	}
+	if entry.Published != "2023-11-10T05:00:00Z" || entry.Updated != "2024-01-29T09:30:00Z" {
+		t.Errorf("atom entry published %q, updated %q", entry.Published, entry.Updated)
+	}
+	if entry.Content == nil || !strings.Contains(entry.Content.Body, "]]>") {
+		t.Errorf("atom content = %+v", entry.Content)
+	}
+	links := map[string]atomLink{}
+	for _, link := range entry.Links {
+		links[link.Rel] = link
+	}
+	if links["alternate"].Href != page.URL || links["enclosure"].Href != imageURL || links["enclosure"].Type != "image/png" {
+		t.Errorf("atom links = %+v", entry.Links)
+	}
+
+	var jf jsonFeed
+	if err := json.Unmarshal(read("feed.json"), &jf); err != nil {
+		t.Fatalf("feed.json isn't valid JSON: %v", err)
+	}
+	if jf.FeedURL != "https://example.com/feed.json" || len(jf.Items) != 1 {
+		t.Fatalf("json feed %s with %d items", jf.FeedURL, len(jf.Items))
+	}
+	ji := jf.Items[0]
+	if ji.ID != page.URL || ji.URL != page.URL || ji.Title != title || ji.Summary != summary || ji.Image != imageURL {
+		t.Errorf("json item = %+v", ji)
+	}
+	if ji.DatePublished != "2023-11-10T00:00:00-05:00" || ji.DateModified != "2024-01-29T09:30:00Z" {
+		t.Errorf("json item published %q, modified %q", ji.DatePublished, ji.DateModified)
+	}
+	if !strings.Contains(ji.ContentHTML, "]]>") {
+		t.Errorf("json content_html = %q", ji.ContentHTML)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// yamlErrorPattern matches the line number yaml.v2 puts in its errors.
+var yamlErrorPattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// jsonFrontmatterPattern matches the start of a JSON object, telling it apart
+// from markdown that opens with a shortcode or a {#id} attribute.
+var jsonFrontmatterPattern = regexp.MustCompile(`^\{\s*["}]`)
+
+// frontmatterError is a problem with a page's frontmatter at a line of its
+// source file.
+type frontmatterError struct {
+	path string
+	line int
+	msg  string
+}
+
+func (e *frontmatterError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.path, e.line, e.msg)
+}
+
+// Frontmatter formats, named after the delimiter that starts them
+const (
+	yamlFrontmatter = "---"
+	tomlFrontmatter = "+++"
+	jsonFrontmatter = "{"
+)
+
+// rawFrontmatter is the undecoded frontmatter at the start of a file.
+type rawFrontmatter struct {
+	format string
+	text   string
+	body   string
+	// Lines of the file before text, so errors point at lines of the file
+	offset int
+}
+
+// splitFrontmatter separates the frontmatter at the start of content from the
+// markdown body. YAML and TOML frontmatter must be fenced by "---" or "+++"
+// lines, the first of which is the first line of the file. JSON frontmatter
+// is an object starting at the first character of the file, whose first key
+// or closing brace follows the opening one. It returns nil when the file has
+// no frontmatter.
+func splitFrontmatter(content string) (*rawFrontmatter, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+
+	if jsonFrontmatterPattern.MatchString(content) {
+		dec := json.NewDecoder(strings.NewReader(content))
+		var object json.RawMessage
+		if err := dec.Decode(&object); err != nil {
+			// Hand everything over so decoding reports the syntax error
+			return &rawFrontmatter{format: jsonFrontmatter, text: content}, nil
+		}
+		end := int(dec.InputOffset())
+		return &rawFrontmatter{format: jsonFrontmatter, text: content[:end], body: content[end:]}, nil
+	}
+
+	firstLine, rest := content, ""
+	if i := strings.Index(content, "\n"); i >= 0 {
+		firstLine, rest = content[:i], content[i+1:]
+	}
+
+	delimiter := strings.TrimRight(firstLine, " \t\r")
+	if delimiter != yamlFrontmatter && delimiter != tomlFrontmatter {
+		return nil, nil
+	}
+
+	lines := strings.SplitAfter(rest, "\n")
+	for i, line := range lines {
+		if strings.TrimRight(line, " \t\r\n") == delimiter {
+			return &rawFrontmatter{
+				format: delimiter,
+				text:   strings.Join(lines[:i], ""),
+				body:   strings.Join(lines[i+1:], ""),
+				offset: 1,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("frontmatter opened with %q is never closed", delimiter)
+}
+
+// decodeFrontmatter decodes raw into frontmatter and returns its keys and
+// values as written. In strict mode unknown keys are rejected.
+func decodeFrontmatter(path string, raw *rawFrontmatter, strict bool, frontmatter *Frontmatter) (map[string]interface{}, []error) {
+	if raw.format == yamlFrontmatter {
+		if errs := unmarshalFrontmatter(path, raw.text, raw.offset, strict, frontmatter); len(errs) > 0 {
+			return nil, errs
+		}
+		values := map[string]interface{}{}
+		yaml.Unmarshal([]byte(raw.text), &values)
+		return values, nil
+	}
+
+	var values map[string]interface{}
+	if raw.format == tomlFrontmatter {
+		if _, err := toml.Decode(raw.text, &values); err != nil {
+			line, msg := 1, err.Error()
+			var parseErr toml.ParseError
+			if errors.As(err, &parseErr) {
+				line, msg = parseErr.Position.Line, parseErr.Message
+			}
+			return nil, []error{&frontmatterError{path, line + raw.offset, msg}}
+		}
+	} else {
+		if err := json.Unmarshal([]byte(raw.text), &values); err != nil {
+			line := 1
+			if syntaxErr, ok := err.(*json.SyntaxError); ok {
+				line += strings.Count(raw.text[:syntaxErr.Offset], "\n")
+			}
+			return nil, []error{&frontmatterError{path, line + raw.offset, err.Error()}}
+		}
+	}
+
+	// Go through YAML one key at a time so the struct's yaml tags apply and
+	// each error can be pinned to the line setting the key
+	keys := []string{}
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	unmarshal := yaml.Unmarshal
+	if strict {
+		unmarshal = yaml.UnmarshalStrict
+	}
+
+	errs := []error{}
+	for _, key := range keys {
+		content, err := yaml.Marshal(map[string]interface{}{key: values[key]})
+		if err == nil {
+			err = unmarshal(content, frontmatter)
+		}
+		if err == nil {
+			continue
+		}
+
+		messages := []string{err.Error()}
+		if typeErr, ok := err.(*yaml.TypeError); ok {
+			messages = typeErr.Errors
+		}
+		for _, msg := range messages {
+			if m := yamlErrorPattern.FindStringSubmatch(msg); m != nil {
+				msg = m[2]
+			}
+			errs = append(errs, &frontmatterError{path, lineContaining(raw.text, key) + raw.offset, msg})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return values, nil
+}
+
+// unmarshalFrontmatter parses the YAML frontmatter of the file at path. In
+// strict mode unknown keys are rejected. Offset is the number of lines in the
+// file before the YAML text starts, so errors point at lines of the file.
+func unmarshalFrontmatter(path, text string, offset int, strict bool, frontmatter *Frontmatter) []error {
+	unmarshal := yaml.Unmarshal
+	if strict {
+		unmarshal = yaml.UnmarshalStrict
+	}
+
+	err := unmarshal([]byte(text), frontmatter)
+	if err == nil {
+		return nil
+	}
+
+	messages := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	}
+
+	errs := []error{}
+	for _, msg := range messages {
+		line := 1
+		if m := yamlErrorPattern.FindStringSubmatch(msg); m != nil {
+			line, _ = strconv.Atoi(m[1])
+			msg = m[2]
+		}
+		errs = append(errs, &frontmatterError{path, line + offset, msg})
+	}
+	return errs
+}
+
+// validateFrontmatter checks that a page sets every key required for its
+// tags and that its templates exist.
+func validateFrontmatter(path, rootDir string, raw *rawFrontmatter, values map[string]interface{}, frontmatter *Frontmatter, required map[string][]string) []error {
+	errs := []error{}
+
+	for _, tag := range frontmatter.Tags {
+		for _, key := range required[tag] {
+			if isBlank(values[key]) {
+				// Point at the start of the frontmatter since the key isn't there
+				errs = append(errs, &frontmatterError{path, 1, fmt.Sprintf("missing required key %q for pages tagged %q", key, tag)})
+			}
+		}
+	}
+
+	for _, tmpl := range frontmatter.Templates {
+		if _, err := os.Stat(filepath.Join(rootDir, tmpl)); err != nil {
+			errs = append(errs, &frontmatterError{path, lineContaining(raw.text, tmpl) + raw.offset, fmt.Sprintf("template %s does not exist", tmpl)})
+		}
+	}
+
+	return errs
+}
+
+func isBlank(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	s, ok := value.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+// lineContaining returns the 1-based line of text that first contains s, or
+// 1 when none does.
+func lineContaining(text, s string) int {
+	for i, line := range strings.Split(text, "\n") {
+		if strings.Contains(line, s) {
+			return i + 1
+		}
+	}
+	return 1
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitFrontmatter(t *testing.T) {
+	tests := []struct {
+		content string
+		format  string
+		text    string
+		body    string
+	}{
+		{"---\ntitle: a\n---\nbody\n", yamlFrontmatter, "title: a\n", "body\n"},
+		{"+++\ntitle = 'a'\n+++\r\nbody", tomlFrontmatter, "title = 'a'\n", "body"},
+		{"{\"title\": \"a\"}\nbody", jsonFrontmatter, "{\"title\": \"a\"}", "\nbody"},
+		{"---\ntitle: a\n---\n\n---\n", yamlFrontmatter, "title: a\n", "\n---\n"},
+		{"# Heading\n\n---\n\nbody ---\n", "", "", ""},
+		{"{\n  }\nbody", jsonFrontmatter, "{\n  }", "\nbody"},
+		{"{{< figure src=\"a.png\" />}}\nbody", "", "", ""},
+		{"{#intro}\n# Intro\n", "", "", ""},
+	}
+
+	for _, test := range tests {
+		raw, err := splitFrontmatter(test.content)
+		if err != nil {
+			t.Errorf("splitFrontmatter(%q) error: %v", test.content, err)
+			continue
+		}
+		if test.format == "" {
+			if raw != nil {
+				t.Errorf("splitFrontmatter(%q) = %+v, want none", test.content, raw)
+			}
+			continue
+		}
+		if raw == nil || raw.format != test.format || raw.text != test.text || raw.body != test.body {
+			t.Errorf("splitFrontmatter(%q) = %+v, want %s %q %q", test.content, raw, test.format, test.text, test.body)
+		}
+	}
+
+	if _, err := splitFrontmatter("---\ntitle: a\n"); err == nil {
+		t.Errorf("splitFrontmatter of unclosed frontmatter returned no error")
+	}
+}
+
+func TestDecodeFrontmatter(t *testing.T) {
+	want := time.Date(2024, 1, 29, 9, 30, 0, 0, time.UTC)
+
+	sources := []string{
+		"---\ntitle: Hello\ndate: 2024-01-29T09:30:00Z\ntags: [post]\ntoc: true\n---\n",
+		"+++\ntitle = \"Hello\"\ndate = 2024-01-29 09:30:00Z\ntags = [\n  'post',\n]\ntoc = true # comment\n+++\n",
+		"{\n  \"title\": \"Hello\",\n  \"date\": \"2024-01-29T09:30:00Z\",\n  \"tags\": [\"post\"],\n  \"toc\": true\n}\n",
+	}
+
+	for _, source := range sources {
+		raw, err := splitFrontmatter(source)
+		if err != nil || raw == nil {
+			t.Fatalf("splitFrontmatter(%q) = %v, %v", source, raw, err)
+		}
+
+		var fm Frontmatter
+		if _, errs := decodeFrontmatter("page.md", raw, true, &fm); len(errs) > 0 {
+			t.Errorf("decodeFrontmatter(%q) errors: %v", source, errs)
+			continue
+		}
+		if fm.Title != "Hello" || !fm.Date.Equal(want) || len(fm.Tags) != 1 || fm.Tags[0] != "post" || !fm.ShowTOC {
+			t.Errorf("decodeFrontmatter(%q) = %+v", source, fm)
+		}
+	}
+}
+
+func TestDecodeFrontmatterErrorLines(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"+++\ntitle = 'a'\ntitel = 'b'\n+++\n", "page.md:3: field titel not found in type main.Frontmatter"},
+		{"+++\ntitle = 'a'\ntags = [1,\n+++\n", "page.md:3: unexpected EOF; expected value"},
+		{"+++\n[data]\ncount = 010\n+++\n", `page.md:3: Invalid integer "010": cannot have leading zeroes`},
+		{"+++\n[data]\na = 1\n[data]\nb = 2\n+++\n", "page.md:4: Key 'data' has already been defined."},
+		{"{\n\"title\": \"a\",\n\"title\"\n}\n", "page.md:4: invalid character '}' after object key"},
+	}
+
+	for _, test := range tests {
+		raw, _ := splitFrontmatter(test.source)
+		var fm Frontmatter
+		_, errs := decodeFrontmatter("page.md", raw, true, &fm)
+		if len(errs) != 1 || errs[0].Error() != test.want {
+			t.Errorf("decodeFrontmatter(%q) errors = %v, want %q", test.source, errs, test.want)
+		}
+	}
+}
+
+func TestDecodeTOMLFrontmatter(t *testing.T) {
+	raw, err := splitFrontmatter(`+++
+title = "a \"quoted\" \u00e9"
+
+[data]
+path = 'C:\dir'
+count = 1_000
+ratio = 0.5
+text = """
+first \
+  second"""
+site.owner = "me"
+links = { home = "/", about = "/about" }
+
+[[data.jobs]]
+title = "one"
+
+[[data.jobs]]
+title = "two"
++++
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fm Frontmatter
+	values, errs := decodeFrontmatter("page.md", raw, true, &fm)
+	if len(errs) > 0 {
+		t.Fatalf("decodeFrontmatter errors: %v", errs)
+	}
+	if fm.Title != "a \"quoted\" é" {
+		t.Errorf("title = %q", fm.Title)
+	}
+
+	data := values["data"].(map[string]interface{})
+	checks := map[string]interface{}{
+		"path":  `C:\dir`,
+		"count": int64(1000),
+		"ratio": 0.5,
+		"text":  "first second",
+	}
+	for key, want := range checks {
+		if data[key] != want {
+			t.Errorf("data.%s = %#v, want %#v", key, data[key], want)
+		}
+	}
+
+	if owner := data["site"].(map[string]interface{})["owner"]; owner != "me" {
+		t.Errorf("data.site.owner = %#v, want \"me\"", owner)
+	}
+	if about := data["links"].(map[string]interface{})["about"]; about != "/about" {
+		t.Errorf("data.links.about = %#v, want \"/about\"", about)
+	}
+	jobs := data["jobs"].([]map[string]interface{})
+	if len(jobs) != 2 || jobs[1]["title"] != "two" {
+		t.Errorf("data.jobs = %#v", jobs)
+	}
+}
+
+func TestValidateFrontmatter(t *testing.T) {
+	rootDir := writeFiles(t, map[string]string{"templates/base.html": ""})
+	required := map[string][]string{"post": {"title", "date", "summary"}}
+
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"complete post", "title: A\ndate: 2024-01-29\nsummary: S\ntags: [post]\n", nil},
+		{"untagged", "title: A\n", nil},
+		{"no requirements for tag", "title: A\ntags: [books]\n", nil},
+		{"missing key", "title: A\ndate: 2024-01-29\ntags: [post]\n", []string{
+			`page.md:1: missing required key "summary" for pages tagged "post"`,
+		}},
+		{"blank key", "title: ' '\ndate: 2024-01-29\nsummary: S\ntags: [post]\n", []string{
+			`page.md:1: missing required key "title" for pages tagged "post"`,
+		}},
+		{"missing template", "title: A\ntemplates:\n  - templates/base.html\n  - templates/post.html\n", []string{
+			"page.md:5: template templates/post.html does not exist",
+		}},
+	}
+
+	for _, tt := range tests {
+		raw, err := splitFrontmatter("---\n" + tt.source + "---\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fm Frontmatter
+		values, errs := decodeFrontmatter("page.md", raw, true, &fm)
+		if len(errs) > 0 {
+			t.Fatalf("%s: decodeFrontmatter errors: %v", tt.name, errs)
+		}
+
+		got := []string{}
+		for _, err := range validateFrontmatter("page.md", rootDir, raw, values, &fm, required) {
+			got = append(got, err.Error())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: validateFrontmatter = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildFrontmatterChecks(t *testing.T) {
+	tests := []struct {
+		name          string
+		noFrontmatter string
+		page          string
+		strict        bool
+		wantErr       bool
+		wantLog       string
+	}{
+		{"skip file without frontmatter", "skip", "# Notes\n", false, false, ""},
+		{"warn about file without frontmatter", "warn", "# Notes\n", false, false, "Warning: Skipping file"},
+		{"fail on file without frontmatter", "error", "# Notes\n", false, true, "no frontmatter found"},
+		{"missing required key", "skip", "---\ntitle: Post\ndate: 2024-01-29\ntags: [post]\n---\n", true, true, `missing required key "summary" for pages tagged "post"`},
+		{"missing required key without strict", "skip", "---\ntitle: Post\ndate: 2024-01-29\ntags: [post]\n---\n", false, false, ""},
+		{"unknown key", "skip", "---\ntitle: Post\ntitel: Post\n---\n", true, true, "page.md:3: field titel not found"},
+		{"unknown key without strict", "skip", "---\ntitle: Post\ntitel: Post\n---\n", false, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := newTestSite(t, map[string]string{
+				configFileName: "title: Test\nauthor: Tester\nurl: https://example.com\ntemplates: [templates/*]\n" +
+					"required:\n  post: [title, date, summary]\nnoFrontmatter: " + tt.noFrontmatter + "\n",
+				"_defaults.yaml":      "templates: [templates/base.html]\n",
+				"templates/base.html": `{{ .Title }}`,
+				"page.md":             tt.page,
+			})
+
+			var logs strings.Builder
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			err := build(rootDir, buildOptions{jobs: 1, strict: tt.strict})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("build error = %v, want error %t\n%s", err, tt.wantErr, logs.String())
+			}
+			if tt.wantLog == "" && logs.Len() > 0 {
+				t.Errorf("build logged %q, want nothing", logs.String())
+			}
+			if !strings.Contains(logs.String(), tt.wantLog) {
+				t.Errorf("build logged %q, want %q", logs.String(), tt.wantLog)
+			}
+		})
+	}
+}
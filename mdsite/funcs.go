@@ -0,0 +1,508 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+// libraryFuncs returns the general purpose template functions for formatting
+// values and filtering, sorting and grouping lists such as .Site.Pages, so
+// new listings don't need changes to mdsite.
+func libraryFuncs() template.FuncMap {
+	return template.FuncMap{
+		"dateFormat":  dateFormat,
+		"markdownify": markdownify,
+		"slugify":     slugify,
+		"truncate":    truncate,
+		"jsonify":     jsonify,
+		"where":       where,
+		"sortBy":      sortBy,
+		"first":       first,
+		"groupBy":     groupBy,
+		"union":       union,
+		"intersect":   intersect,
+	}
+}
+
+// siteFuncs returns the template functions that depend on the site's URL.
+func siteFuncs(site *Site) template.FuncMap {
+	siteURL := ""
+	if site != nil {
+		siteURL = site.URL
+	}
+	return template.FuncMap{
+		"absURL": func(ref string) string {
+			return absURL(siteURL, ref)
+		},
+		"relURL": func(ref string) string {
+			return relURL(siteURL, ref)
+		},
+	}
+}
+
+// dateFormat formats a time, or a date string as written in frontmatter,
+// with layout. An optional IANA timezone such as "America/New_York" converts
+// the time before formatting.
+func dateFormat(layout string, value interface{}, timezone ...string) (string, error) {
+	t, err := toTime(value)
+	if err != nil {
+		return "", err
+	}
+	if len(timezone) > 0 && timezone[0] != "" {
+		loc, err := time.LoadLocation(timezone[0])
+		if err != nil {
+			return "", fmt.Errorf("Unknown timezone %s: %w", timezone[0], err)
+		}
+		t = t.In(loc)
+	}
+	return t.Format(layout), nil
+}
+
+func toTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("Can't use %v as a date", value)
+}
+
+// absURL returns ref as an absolute URL under the site's URL. URLs that
+// already have a scheme are returned unchanged.
+func absURL(siteURL, ref string) string {
+	if u, err := url.Parse(ref); err == nil && u.IsAbs() {
+		return ref
+	}
+	return strings.TrimSuffix(siteURL, "/") + "/" + strings.TrimPrefix(ref, "/")
+}
+
+// relURL returns ref as a root-relative URL under the path of the site's URL,
+// which is what links need when the site isn't served from the domain root.
+// Absolute URLs pointing at the site are made relative too.
+func relURL(siteURL, ref string) string {
+	base, err := url.Parse(siteURL)
+	if err != nil {
+		return ref
+	}
+	if u, err := url.Parse(ref); err == nil && u.IsAbs() {
+		if u.Host != base.Host {
+			return ref
+		}
+		u.Scheme = ""
+		u.Host = ""
+		return u.String()
+	}
+	rel := path.Join("/", base.Path, ref)
+	if strings.HasSuffix(ref, "/") && rel != "/" {
+		rel += "/"
+	}
+	return rel
+}
+
+// markdownify renders markdown to HTML. Text that renders to a single
+// paragraph is returned without the enclosing p element so it can be used
+// inline.
+func markdownify(source string) string {
+	doc := markdown.Parse([]byte(source), parser.NewWithExtensions(markdownExtensions))
+	opts := html.RendererOptions{
+		Flags: html.CommonFlags,
+	}
+	rendered := strings.TrimSpace(string(markdown.Render(doc, html.NewRenderer(opts))))
+
+	inner := strings.TrimSuffix(strings.TrimPrefix(rendered, "<p>"), "</p>")
+	if len(inner) == len(rendered)-len("<p></p>") && !strings.Contains(inner, "<p>") {
+		return inner
+	}
+	return rendered
+}
+
+// truncate shortens s to at most length characters, cutting at the last word
+// boundary and adding an ellipsis.
+func truncate(length int, s string) string {
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	runes := []rune(s)
+	cut := string(runes[:length])
+	if i := strings.LastIndexAny(cut, " \t\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \t\n.,;:") + "…"
+}
+
+// jsonify encodes value as JSON.
+func jsonify(value interface{}) (string, error) {
+	content, err := json.Marshal(normalizeYAML(value))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// where returns the items of collection whose key equals value. With three
+// arguments the second is an operator: ==, !=, <, <=, >, >=, in (the key's
+// value is one of a list) or has (the key's value is a list containing
+// value), as in where .Site.Pages "Tags" "has" "post".
+func where(collection interface{}, key string, args ...interface{}) ([]interface{}, error) {
+	op := "=="
+	var value interface{}
+	switch len(args) {
+	case 1:
+		value = args[0]
+	case 2:
+		var ok bool
+		if op, ok = args[0].(string); !ok {
+			return nil, fmt.Errorf("where operator must be a string, got %v", args[0])
+		}
+		value = args[1]
+	default:
+		return nil, fmt.Errorf("where takes a value or an operator and a value")
+	}
+
+	if _, err := compareOp(op, nil, nil); err != nil {
+		return nil, err
+	}
+
+	items, err := toList(collection)
+	if err != nil {
+		return nil, err
+	}
+	matches := []interface{}{}
+	for _, item := range items {
+		field, ok := lookupKey(item, key)
+		if !ok {
+			continue
+		}
+		if match, _ := compareOp(op, field, value); match {
+			matches = append(matches, item)
+		}
+	}
+	return matches, nil
+}
+
+func compareOp(op string, field, value interface{}) (bool, error) {
+	ordered := func(test func(int) bool) bool {
+		c, ok := compareScalars(field, value)
+		return ok && test(c)
+	}
+	switch op {
+	case "==", "=", "eq":
+		return valuesEqual(field, value), nil
+	case "!=", "ne":
+		return !valuesEqual(field, value), nil
+	case "<", "lt":
+		return ordered(func(c int) bool { return c < 0 }), nil
+	case "<=", "le":
+		return ordered(func(c int) bool { return c <= 0 }), nil
+	case ">", "gt":
+		return ordered(func(c int) bool { return c > 0 }), nil
+	case ">=", "ge":
+		return ordered(func(c int) bool { return c >= 0 }), nil
+	case "in":
+		return listContains(value, field), nil
+	case "not in":
+		return !listContains(value, field), nil
+	case "has":
+		return listContains(field, value), nil
+	}
+	return false, fmt.Errorf("Unknown where operator %s", op)
+}
+
+func listContains(list, value interface{}) bool {
+	items, err := toList(list)
+	if err != nil {
+		return false
+	}
+	for _, item := range items {
+		if valuesEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortBy returns a copy of collection sorted by key, in ascending order
+// unless order is "desc". Items with equal keys, or keys that have no order,
+// keep their order.
+func sortBy(collection interface{}, key string, order ...string) ([]interface{}, error) {
+	items, err := toList(collection)
+	if err != nil {
+		return nil, err
+	}
+	desc := len(order) > 0 && strings.EqualFold(order[0], "desc")
+
+	sorted := append([]interface{}{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _ := lookupKey(sorted[i], key)
+		b, _ := lookupKey(sorted[j], key)
+		c, ok := compareScalars(a, b)
+		if desc {
+			return ok && c > 0
+		}
+		return ok && c < 0
+	})
+	return sorted, nil
+}
+
+// first returns the first n items of collection.
+func first(n int, collection interface{}) ([]interface{}, error) {
+	items, err := toList(collection)
+	if err != nil {
+		return nil, err
+	}
+	if n >= 0 && n < len(items) {
+		items = items[:n]
+	}
+	return items, nil
+}
+
+// Group is a set of items sharing a key, as returned by groupBy.
+type Group struct {
+	Key   string
+	Items []interface{}
+}
+
+// groupBy splits collection into groups sharing the value of key, in the
+// order each key first appears. Dates are grouped by year, so a list of
+// posts sorted newest first gives one group per year, newest first.
+func groupBy(collection interface{}, key string) ([]*Group, error) {
+	items, err := toList(collection)
+	if err != nil {
+		return nil, err
+	}
+	groups := []*Group{}
+	byKey := map[string]*Group{}
+	for _, item := range items {
+		value, _ := lookupKey(item, key)
+		var name string
+		if t, ok := value.(time.Time); ok {
+			name = t.Format("2006")
+		} else {
+			name = fmt.Sprint(value)
+		}
+		group, ok := byKey[name]
+		if !ok {
+			group = &Group{Key: name}
+			byKey[name] = group
+			groups = append(groups, group)
+		}
+		group.Items = append(group.Items, item)
+	}
+	return groups, nil
+}
+
+// union returns the items of every collection without duplicates, in the
+// order they first appear.
+func union(collections ...interface{}) ([]interface{}, error) {
+	items := []interface{}{}
+	for _, collection := range collections {
+		list, err := toList(collection)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list {
+			if !listContains(items, item) {
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+// intersect returns the items of the first collection that are also in every
+// other one, in their order in the first.
+func intersect(first interface{}, others ...interface{}) ([]interface{}, error) {
+	items, err := toList(first)
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range others {
+		list, err := toList(other)
+		if err != nil {
+			return nil, err
+		}
+		kept := []interface{}{}
+		for _, item := range items {
+			if listContains(list, item) {
+				kept = append(kept, item)
+			}
+		}
+		items = kept
+	}
+	return items, nil
+}
+
+// toList returns the elements of a slice or array. A nil collection, such as
+// a missing tag in .Site.PagesByTag, is empty.
+func toList(collection interface{}) ([]interface{}, error) {
+	if collection == nil {
+		return []interface{}{}, nil
+	}
+	v := reflect.ValueOf(collection)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("Expected a list, got %T", collection)
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// lookupKey returns the value of a dotted path of field names, methods
+// without arguments and map keys on item, such as "Date" on a page or
+// "company" on a data file entry.
+func lookupKey(item interface{}, key string) (interface{}, bool) {
+	v := reflect.ValueOf(item)
+	for _, name := range strings.Split(key, ".") {
+		if !v.IsValid() {
+			return nil, false
+		}
+		if m := v.MethodByName(name); m.IsValid() && m.Type().NumIn() == 0 && m.Type().NumOut() == 1 {
+			v = m.Call(nil)[0]
+			continue
+		}
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil, false
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			v = v.FieldByName(name)
+		case reflect.Map:
+			v = v.MapIndex(reflect.ValueOf(name))
+		default:
+			return nil, false
+		}
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+// valuesEqual reports whether a and b are the same value. Scalars are
+// compared by value, lists and maps element by element, and pointers such as
+// pages by identity, so a page is never read while another render fills it in.
+func valuesEqual(a, b interface{}) bool {
+	if c, ok := compareScalars(a, b); ok {
+		return c == 0
+	}
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Type() != vb.Type() {
+		return false
+	}
+	switch va.Kind() {
+	case reflect.Slice, reflect.Array:
+		if va.Len() != vb.Len() {
+			return false
+		}
+		for i := 0; i < va.Len(); i++ {
+			if !valuesEqual(va.Index(i).Interface(), vb.Index(i).Interface()) {
+				return false
+			}
+		}
+		return true
+	case reflect.Map:
+		if va.Len() != vb.Len() {
+			return false
+		}
+		iter := va.MapRange()
+		for iter.Next() {
+			other := vb.MapIndex(iter.Key())
+			if !other.IsValid() || !valuesEqual(iter.Value().Interface(), other.Interface()) {
+				return false
+			}
+		}
+		return true
+	}
+	return va.Type().Comparable() && a == b
+}
+
+// compareScalars orders numbers numerically, times chronologically, and
+// strings and booleans by value. It reports false when a and b aren't both
+// one of those, since other values have no order.
+func compareScalars(a, b interface{}) (int, bool) {
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			switch {
+			case ta.Before(tb):
+				return -1, true
+			case ta.After(tb):
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1, true
+			case fa > fb:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !va.IsValid() || !vb.IsValid() || va.Kind() != vb.Kind() {
+		return 0, false
+	}
+	switch va.Kind() {
+	case reflect.String:
+		return strings.Compare(va.String(), vb.String()), true
+	case reflect.Bool:
+		switch {
+		case va.Bool() == vb.Bool():
+			return 0, true
+		case vb.Bool():
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
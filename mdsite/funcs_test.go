@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestLibraryFuncs(t *testing.T) {
+	site := &Site{URL: "https://example.com/blog", PagesByTag: map[string][]*Page{}}
+	newPage := func(title string, date time.Time, tags ...string) *Page {
+		p := &Page{Site: site, Frontmatter: &Frontmatter{Title: title, Date: date, Tags: tags}}
+		site.Pages = append(site.Pages, p)
+		return p
+	}
+	newPage("a", time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), "post")
+	newPage("b", time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC), "post", "go")
+	newPage("c", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), "other")
+	newPage("d", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), "post")
+	site.Data = map[string]interface{}{"titles": []interface{}{"b", "c"}, "jobs": []interface{}{
+		map[string]interface{}{"company": "x", "start": 2019},
+		map[string]interface{}{"company": "y", "start": 2015},
+	}}
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{`{{ dateFormat "2006-01-02 15:04" (index .Site.Pages 1).Date "America/New_York" }}`, "2024-01-01 22:00"},
+		{`{{ dateFormat "Jan 2, 2006" "2024-03-05" }}`, "Mar 5, 2024"},
+		{`{{ absURL "/tags/" }} {{ absURL "https://other.org/x" }}`, "https://example.com/blog/tags/ https://other.org/x"},
+		{`{{ relURL "tags/" }} {{ relURL "https://example.com/blog/a.html" }}`, "/blog/tags/ /blog/a.html"},
+		{`{{ markdownify "*hi* there" }}`, "<em>hi</em> there"},
+		{`{{ slugify "Hello, World" }}`, "hello-world"},
+		{`{{ truncate 12 "The quick brown fox" }}`, "The quick…"},
+		{`{{ truncate 50 "short" }}`, "short"},
+		{`{{ jsonify .Site.Data.jobs }}`, `[{"company":"x","start":2019},{"company":"y","start":2015}]`},
+		{`{{ range where .Site.Pages "Tags" "has" "post" }}{{ .Title }}{{ end }}`, "abd"},
+		{`{{ range where .Site.Pages "Title" "!=" "a" }}{{ .Title }}{{ end }}`, "bcd"},
+		{`{{ range where .Site.Pages "Title" "in" .Site.Data.titles }}{{ .Title }}{{ end }}`, "bc"},
+		{`{{ range where .Site.Data.jobs "start" ">" 2016 }}{{ .company }}{{ end }}`, "x"},
+		{`{{ range sortBy .Site.Pages "Date" "desc" }}{{ .Title }}{{ end }}`, "cbad"},
+		{`{{ range sortBy .Site.Data.jobs "start" }}{{ .company }}{{ end }}`, "yx"},
+		{`{{ range first 2 (sortBy .Site.Pages "Title") }}{{ .Title }}{{ end }}`, "ab"},
+		{`{{ range groupBy (sortBy .Site.Pages "Date" "desc") "Date" }}{{ .Key }}:{{ range .Items }}{{ .Title }}{{ end }} {{ end }}`, "2024:cb 2023:a 2022:d "},
+		{`{{ range union .Site.PagesByTag.missing (where .Site.Pages "Title" "a") .Site.Pages }}{{ .Title }}{{ end }}`, "abcd"},
+	}
+
+	for _, test := range tests {
+		funcs := templateFuncs()
+		for name, fn := range siteFuncs(site) {
+			funcs[name] = fn
+		}
+		tmpl, err := template.New("test").Funcs(funcs).Parse(test.tmpl)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", test.tmpl, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, map[string]interface{}{"Site": site}); err != nil {
+			t.Errorf("Execute(%q): %v", test.tmpl, err)
+			continue
+		}
+		if got := b.String(); got != test.want {
+			t.Errorf("%s = %q, want %q", test.tmpl, got, test.want)
+		}
+	}
+}
+
+func TestWhereErrors(t *testing.T) {
+	if _, err := where([]int{1}, "X", "~", 1); err == nil {
+		t.Error("where with an unknown operator succeeded")
+	}
+	if _, err := where(3, "X", 1); err == nil {
+		t.Error("where on a non-list succeeded")
+	}
+	if _, err := dateFormat("2006", time.Now(), "Not/AZone"); err == nil {
+		t.Error("dateFormat with an unknown timezone succeeded")
+	}
+}
+
+func TestUnionAndIntersectPages(t *testing.T) {
+	pages := []*Page{}
+	for _, title := range []string{"a", "b", "c", "d"} {
+		pages = append(pages, &Page{Frontmatter: &Frontmatter{Title: title}, Markdown: "# " + title})
+	}
+
+	// Pages compare by identity, so they can be listed while other renders
+	// are still parsing them
+	done := make(chan bool)
+	for _, p := range pages {
+		go func(p *Page) {
+			p.parse()
+			done <- true
+		}(p)
+	}
+
+	all, err := union(pages[:3], pages[1:], []*Page{pages[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	both, err := intersect(pages[:3], pages[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range pages {
+		<-done
+	}
+
+	if len(all) != 4 || all[0] != pages[0] || all[3] != pages[3] {
+		t.Errorf("union = %v, want all four pages in order", all)
+	}
+	if len(both) != 2 || both[0] != pages[1] || both[1] != pages[2] {
+		t.Errorf("intersect = %v, want pages b and c", both)
+	}
+
+	// Pages with the same content are still different pages
+	twin := &Page{Frontmatter: &Frontmatter{Title: "a"}}
+	if got, _ := union([]*Page{pages[0]}, []*Page{twin}); len(got) != 2 {
+		t.Errorf("union of two pages with the same title = %d pages, want 2", len(got))
+	}
+}
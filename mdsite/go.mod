@@ -3,6 +3,7 @@ module github.com/kdeloach/kdeloach.github.io/mdsite
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/gomarkdown/markdown v0.0.0-20250810172220-2e2c11897d1a
 	gopkg.in/yaml.v2 v2.4.0
 )
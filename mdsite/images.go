@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ImageSet is an image along with the resized copies generated for it, for
+// use in srcset attributes.
+type ImageSet struct {
+	URL    string
+	Width  int
+	Height int
+	// Resized copies narrowest first, followed by the original
+	Sizes []*ImageSize
+}
+
+type ImageSize struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+// Srcset returns the value of a srcset attribute listing every size.
+func (s *ImageSet) Srcset() string {
+	candidates := []string{}
+	for _, size := range s.Sizes {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", size.URL, size.Width))
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// Attrs returns src, srcset, sizes, width and height attributes for an img
+// element shown at sizes, such as "128px". The src and dimensions are those
+// of the smallest copy, for browsers that ignore srcset.
+func (s *ImageSet) Attrs(sizes string) string {
+	smallest := s.Sizes[0]
+	return fmt.Sprintf(`src="%s" srcset="%s" sizes="%s" width="%d" height="%d"`,
+		smallest.URL, s.Srcset(), sizes, smallest.Width, smallest.Height)
+}
+
+// imageResizer generates resized copies of images the first time a template
+// asks for them. It's safe to use from concurrent renders.
+type imageResizer struct {
+	rootDir string
+	urlPath string
+	config  ImagesConfig
+	// Returns the file a path relative to the site root is written to
+	locate func(string) (string, string)
+
+	mu   sync.Mutex
+	sets map[string]*resizedImage
+}
+
+type resizedImage struct {
+	once sync.Once
+	set  *ImageSet
+	err  error
+}
+
+func newImageResizer(rootDir, siteURLPath string, config ImagesConfig, locate func(string) (string, string)) *imageResizer {
+	return &imageResizer{
+		rootDir: rootDir,
+		urlPath: siteURLPath,
+		config:  config,
+		locate:  locate,
+		sets:    map[string]*resizedImage{},
+	}
+}
+
+// imageSet returns the sizes of the image at src, resolved like a link on
+// page, resizing it if needed.
+func (r *imageResizer) imageSet(page *Page, src string) (*ImageSet, error) {
+	filePath := localPath(r.rootDir, page, src)
+	relPath, err := filepath.Rel(r.rootDir, filePath)
+	if err != nil || strings.HasPrefix(relPath, "..") {
+		return nil, fmt.Errorf("Image %s is outside the site root", src)
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	r.mu.Lock()
+	resized, ok := r.sets[relPath]
+	if !ok {
+		resized = &resizedImage{}
+		r.sets[relPath] = resized
+	}
+	r.mu.Unlock()
+
+	resized.once.Do(func() {
+		resized.set, resized.err = r.resize(filePath, relPath)
+	})
+	return resized.set, resized.err
+}
+
+func (r *imageResizer) resize(filePath, relPath string) (*ImageSet, error) {
+	srcInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading image %s: %w", filePath, err)
+	}
+
+	width, height, err := imageDimensions(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &ImageSet{
+		URL:    path.Join("/", r.urlPath, relPath),
+		Width:  width,
+		Height: height,
+	}
+
+	var src image.Image
+	for _, w := range r.config.Widths {
+		if w <= 0 || w >= width {
+			continue
+		}
+
+		ext := path.Ext(relPath)
+		resizedRel := path.Join(r.config.Path, fmt.Sprintf("%s-%dw%s", strings.TrimSuffix(relPath, ext), w, ext))
+		outputPath, _ := r.locate(resizedRel)
+		size := &ImageSize{
+			URL:    path.Join("/", r.urlPath, resizedRel),
+			Width:  w,
+			Height: scaledHeight(width, height, w),
+		}
+		set.Sizes = append(set.Sizes, size)
+
+		// Keep copies made from the same version of the image
+		if info, err := os.Stat(outputPath); err == nil && !info.ModTime().Before(srcInfo.ModTime()) {
+			continue
+		}
+
+		if src == nil {
+			if src, err = decodeImage(filePath); err != nil {
+				return nil, err
+			}
+		}
+		if err := writeImage(outputPath, resizeImage(src, size.Width, size.Height)); err != nil {
+			return nil, err
+		}
+	}
+
+	set.Sizes = append(set.Sizes, &ImageSize{URL: set.URL, Width: width, Height: height})
+	return set, nil
+}
+
+func imageDimensions(filePath string) (int, int, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error reading image %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error decoding image %s: %w", filePath, err)
+	}
+	return config.Width, config.Height, nil
+}
+
+func decodeImage(filePath string) (image.Image, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading image %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding image %s: %w", filePath, err)
+	}
+	return img, nil
+}
+
+// writeImage encodes img in the format matching the extension of outputPath.
+func writeImage(outputPath string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("Error writing image %s: %w", outputPath, err)
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(f, img, &jpeg.Options{Quality: 85})
+	default:
+		err = png.Encode(f, img)
+	}
+	if err != nil {
+		return fmt.Errorf("Error encoding image %s: %w", outputPath, err)
+	}
+	return f.Close()
+}
+
+func scaledHeight(width, height, newWidth int) int {
+	h := int(math.Round(float64(height) * float64(newWidth) / float64(width)))
+	if h < 1 {
+		return 1
+	}
+	return h
+}
+
+// resizeImage scales src down to width by height, averaging the source
+// pixels each destination pixel covers.
+func resizeImage(src image.Image, width, height int) *image.RGBA {
+	b := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	srcW, srcH := b.Dx(), b.Dy()
+	xWeights := boxWeights(srcW, width)
+	yWeights := boxWeights(srcH, height)
+
+	// Scale each row horizontally, then each column of the result vertically
+	rows := make([]float64, srcH*width*4)
+	for y := 0; y < srcH; y++ {
+		for x, weights := range xWeights {
+			var px [4]float64
+			for _, w := range weights {
+				i := rgba.PixOffset(w.index, y)
+				for c := 0; c < 4; c++ {
+					px[c] += float64(rgba.Pix[i+c]) * w.weight
+				}
+			}
+			copy(rows[(y*width+x)*4:], px[:])
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, weights := range yWeights {
+		for x := 0; x < width; x++ {
+			var px [4]float64
+			for _, w := range weights {
+				i := (w.index*width + x) * 4
+				for c := 0; c < 4; c++ {
+					px[c] += rows[i+c] * w.weight
+				}
+			}
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(math.Min(255, math.Round(px[c])))
+			}
+		}
+	}
+	return dst
+}
+
+type pixelWeight struct {
+	index  int
+	weight float64
+}
+
+// boxWeights returns, for each of dstSize pixels, the source pixels it covers
+// and the share of it each one makes up.
+func boxWeights(srcSize, dstSize int) [][]pixelWeight {
+	scale := float64(srcSize) / float64(dstSize)
+	weights := make([][]pixelWeight, dstSize)
+	for i := range weights {
+		start := float64(i) * scale
+		end := start + scale
+		for j := int(start); j < srcSize && float64(j) < end; j++ {
+			overlap := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if overlap > 0 {
+				weights[i] = append(weights[i], pixelWeight{j, overlap / scale})
+			}
+		}
+	}
+	return weights
+}
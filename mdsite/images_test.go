@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestBoxWeights(t *testing.T) {
+	for _, sizes := range [][2]int{{10, 3}, {844, 128}, {7, 7}} {
+		for i, weights := range boxWeights(sizes[0], sizes[1]) {
+			sum := 0.0
+			for _, w := range weights {
+				sum += w.weight
+			}
+			if math.Abs(sum-1) > 1e-9 {
+				t.Errorf("boxWeights(%d, %d)[%d] sums to %f, want 1", sizes[0], sizes[1], i, sum)
+			}
+		}
+	}
+}
+
+func TestResizeImage(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 9, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 9; x++ {
+			// Left two thirds red, right third blue
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= 6 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			src.Set(x, y, c)
+		}
+	}
+
+	dst := resizeImage(src, 3, 2)
+	if got := dst.Bounds().Size(); got != image.Pt(3, 2) {
+		t.Fatalf("resized to %v, want 3x2", got)
+	}
+	if got := dst.RGBAAt(0, 1); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("pixel (0, 1) = %v, want red", got)
+	}
+	if got := dst.RGBAAt(2, 0); got != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("pixel (2, 0) = %v, want blue", got)
+	}
+
+	// Averages pixels straddling the boundary
+	if got := resizeImage(src, 2, 1).RGBAAt(1, 0); got != (color.RGBA{85, 0, 170, 255}) {
+		t.Errorf("straddling pixel = %v, want {85 0 170 255}", got)
+	}
+}
+
+func TestImageSetAttrs(t *testing.T) {
+	set := &ImageSet{
+		URL:    "/yoto/preview.png",
+		Width:  512,
+		Height: 256,
+		Sizes: []*ImageSize{
+			{URL: "/images/resized/yoto/preview-128w.png", Width: 128, Height: 64},
+			{URL: "/yoto/preview.png", Width: 512, Height: 256},
+		},
+	}
+
+	want := `src="/images/resized/yoto/preview-128w.png" srcset="/images/resized/yoto/preview-128w.png 128w, /yoto/preview.png 512w" sizes="128px" width="128" height="64"`
+	if got := set.Attrs("128px"); got != want {
+		t.Errorf("Attrs = %s, want %s", got, want)
+	}
+}
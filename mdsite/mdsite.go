@@ -2,15 +2,19 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
-	"text/template"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"log"
@@ -18,7 +22,6 @@ import (
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/gomarkdown/markdown/parser"
-	"gopkg.in/yaml.v2"
 )
 
 type Site struct {
@@ -30,8 +33,24 @@ type Site struct {
 	LastBuild   time.Time
 	GitSHA      string
 
+	// Free-form values from the params section of site.yaml
+	Params map[string]interface{}
+
+	// Contents of the files in the data directory, keyed by path
+	Data map[string]interface{}
+	// Hash of the data files, for the build cache
+	dataHash string
+
 	Pages      []*Page
 	PagesByTag map[string][]*Page
+
+	// Every tag sorted by name, with a link to its generated page
+	Tags []*Tag
+	// URL of the generated overview page listing every tag
+	TagsURL string
+
+	// Generated RSS, Atom and JSON feeds
+	Feeds []*Feed
 }
 
 type Page struct {
@@ -44,13 +63,33 @@ type Page struct {
 	Markdown string
 
 	// Calculated fields
-	Content       string
 	URL           string
 	OutputFile    string
 	DateFormatted string
 
 	// Reference to Site for convenient access in templates
 	Site *Site
+
+	// Set on the generated page listing a tag
+	Tag *Tag
+
+	// Files read with Include or as shortcodes while rendering
+	includes []string
+
+	// Expands shortcodes in Markdown. Generated pages have none.
+	templates *templateRegistry
+
+	// Markdown with shortcodes expanded
+	expandOnce sync.Once
+	expanding  atomic.Bool
+	source     string
+
+	parseOnce      sync.Once
+	content        string
+	toc            []*Heading
+	firstParagraph string
+	wordCount      int
+	parseErr       error
 }
 
 type Frontmatter struct {
@@ -62,45 +101,143 @@ type Frontmatter struct {
 	Output    string      `yaml:"output"`
 	Data      interface{} `yaml:"data"`
 	Image     string      `yaml:"image"`
+	Draft     bool        `yaml:"draft"`
+	Updated   time.Time   `yaml:"updated"`
+	Sitemap   *bool       `yaml:"sitemap"`
+	ShowTOC   bool        `yaml:"toc"`
 }
 
 func main() {
+	var opts buildOptions
+	flag.StringVar(&opts.outDir, "out", "", "Directory to write the generated site to (default: next to each source file)")
+	flag.IntVar(&opts.jobs, "jobs", runtime.NumCPU(), "Number of pages to render in parallel")
+	flag.BoolVar(&opts.drafts, "drafts", false, "Include pages marked as draft")
+	flag.BoolVar(&opts.future, "future", false, "Include pages dated in the future")
+	flag.BoolVar(&opts.force, "force", false, "Render every page, ignoring the build cache")
+	flag.BoolVar(&opts.strict, "strict", false, "Fail on unknown or missing frontmatter keys and missing templates")
+	flag.BoolVar(&opts.check, "check", false, "Check links in the generated site instead of building it")
+	watch := flag.Bool("watch", false, "Rebuild whenever a page, template or include changes")
+	poll := flag.Duration("poll", 500*time.Millisecond, "How often to check for changes with -watch")
+	flag.Parse()
+
 	rootDir := "."
-	if len(os.Args) > 1 {
-		rootDir = os.Args[1]
+	if flag.NArg() > 0 {
+		rootDir = flag.Arg(0)
 	}
 
-	siteURL, err := url.Parse("https://kdeloach.me")
-	if err != nil {
-		log.Printf("error parsing URL: %s", err)
+	if *watch {
+		if opts.check {
+			log.Fatalf("-watch can't be combined with -check")
+		}
+		watchSite(rootDir, opts, *poll)
 		return
 	}
 
+	if err := build(rootDir, opts); err != nil {
+		if err != errBuildFailed {
+			log.Print(err)
+		}
+		os.Exit(1)
+	}
+}
+
+// buildOptions are the command line flags that control a build.
+type buildOptions struct {
+	outDir string
+	jobs   int
+	drafts bool
+	future bool
+	force  bool
+	strict bool
+	check  bool
+}
+
+// errBuildFailed is returned by build once the errors that failed it have
+// been logged.
+var errBuildFailed = errors.New("build failed")
+
+// build generates the site under rootDir, or checks its links with -check.
+func build(rootDir string, opts buildOptions) error {
+	config, err := loadConfig(rootDir)
+	if err != nil {
+		return fmt.Errorf("Error loading site config: %w", err)
+	}
+
+	siteURL, err := url.Parse(config.URL)
+	if err != nil {
+		return fmt.Errorf("Error parsing URL: %w", err)
+	}
+
 	gitSHA, err := getCurrentGitSHA(rootDir)
 	if err != nil {
-		log.Printf("error getting git SHA: %s", err)
-		return
+		return fmt.Errorf("Error getting git SHA: %w", err)
 	}
 
 	site := &Site{}
 	site.Pages = []*Page{}
 	site.PagesByTag = map[string][]*Page{}
 
-	// TODO: Move to site settings file
-	site.Title = "Kevin DeLoach"
-	site.Author = "Kevin DeLoach"
-	site.Description = "Full Stack Software Engineer, Philadelphia, PA"
+	site.Title = config.Title
+	site.Author = config.Author
+	site.Description = config.Description
 	site.URL = siteURL.String()
-	site.PubDate = time.Date(2021, time.December, 30, 12, 0, 0, 0, time.UTC) // Datecalc post publish date (first post)
+	site.PubDate = config.PubDate
+	site.Params = config.Params
 	site.LastBuild = time.Now().UTC()
 	site.GitSHA = gitSHA
 
+	site.Data, site.dataHash, err = loadData(filepath.Join(rootDir, config.Data))
+	if err != nil {
+		return fmt.Errorf("Error loading data: %w", err)
+	}
+
+	templates := newTemplateRegistry(rootDir)
+
+	// Assets are only fingerprinted when building into a separate output
+	// directory, so building in place never adds files next to the sources
+	templates.assets, err = loadAssets(rootDir, siteURL.Path, config.Assets, opts.outDir != "")
+	if err != nil {
+		return fmt.Errorf("Error loading assets: %w", err)
+	}
+
+	cache, err := openBuildCache(rootDir, opts.outDir, opts.force, templates)
+	if err != nil {
+		return fmt.Errorf("Error opening build cache: %w", err)
+	}
+
+	// locatePage returns the file a page is written to and the URL it's
+	// served from, given its output path relative to the site root.
+	locatePage := func(relPath string) (string, string) {
+		outputPath := filepath.Join(rootDir, relPath)
+		if opts.outDir != "" {
+			outputPath = filepath.Join(opts.outDir, relPath)
+		}
+
+		// omit index.html from path if present
+		urlPath := strings.TrimSuffix(filepath.ToSlash(relPath), "index.html")
+
+		url := *siteURL
+		url.Path = urlPath
+
+		return outputPath, url.String()
+	}
+
+	templates.images = newImageResizer(rootDir, siteURL.Path, config.Images, locatePage)
+
+	defaults, err := newFrontmatterDefaults(rootDir, config.Defaults, opts.strict)
+	if err != nil {
+		return fmt.Errorf("Error loading frontmatter defaults: %w", err)
+	}
+
+	// Frontmatter problems found with -strict
+	frontmatterErrs := []error{}
+
 	processMarkdownFile := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return fmt.Errorf("Error accessing file %s: %w", path, err)
 		}
 
-		if info.IsDir() && strings.Contains(path, "node_modules") {
+		if info.IsDir() && (isSkippedDir(path) || (opts.outDir != "" && isWithinDir(path, opts.outDir))) {
 			return filepath.SkipDir
 		}
 
@@ -110,15 +247,61 @@ func main() {
 				return fmt.Errorf("Error reading file %s: %w", path, err)
 			}
 
-			parts := strings.SplitN(string(content), "---", 3)
-			if len(parts) < 3 {
-				log.Printf("Warning: Skipping file %s: No valid frontmatter found", path)
+			raw, err := splitFrontmatter(string(content))
+			if err != nil {
+				err = &frontmatterError{path, 1, err.Error()}
+				if opts.strict {
+					frontmatterErrs = append(frontmatterErrs, err)
+				} else {
+					log.Printf("Warning: %v", err)
+				}
+				return nil
+			}
+			if raw == nil {
+				switch config.NoFrontmatter {
+				case "warn":
+					log.Printf("Warning: Skipping file %s: No frontmatter found", path)
+				case "error":
+					frontmatterErrs = append(frontmatterErrs, &frontmatterError{path, 1, "no frontmatter found"})
+				}
 				return nil
 			}
 
 			var frontmatter Frontmatter
-			if err := yaml.Unmarshal([]byte(parts[1]), &frontmatter); err != nil {
-				log.Printf("Warning: Error parsing YAML in file %s: %v", path, err)
+			defaultValues, defaultsSource, err := defaults.apply(path, &frontmatter)
+			if err != nil {
+				return err
+			}
+
+			values, errs := decodeFrontmatter(path, raw, opts.strict, &frontmatter)
+			if len(errs) > 0 {
+				if opts.strict {
+					frontmatterErrs = append(frontmatterErrs, errs...)
+					return nil
+				}
+				for _, err := range errs {
+					log.Printf("Warning: Error parsing frontmatter: %v", err)
+				}
+				return nil
+			}
+
+			for key, value := range defaultValues {
+				if _, ok := values[key]; !ok {
+					values[key] = value
+				}
+			}
+
+			if opts.strict {
+				frontmatterErrs = append(frontmatterErrs, validateFrontmatter(path, rootDir, raw, values, &frontmatter, config.Required)...)
+			}
+
+			if frontmatter.Draft && !opts.drafts {
+				fmt.Printf("Skipped draft %s\n", path)
+				return nil
+			}
+
+			if frontmatter.Date.After(site.LastBuild) && !opts.future {
+				fmt.Printf("Skipped %s scheduled for %s\n", path, frontmatter.Date.Format("Jan 2, 2006"))
 				return nil
 			}
 
@@ -139,11 +322,7 @@ func main() {
 				return err
 			}
 
-			// omit index.html from path if present
-			urlPath := strings.TrimSuffix(relPath, "index.html")
-
-			url := *siteURL
-			url.Path = urlPath
+			outputPath, pageURL := locatePage(relPath)
 
 			dateFormatted := ""
 			if !frontmatter.Date.IsZero() {
@@ -155,12 +334,15 @@ func main() {
 				Path:          path,
 				Dir:           filepath.Dir(path),
 				Frontmatter:   &frontmatter,
-				Markdown:      parts[2],
-				URL:           url.String(),
+				Markdown:      raw.body,
+				URL:           pageURL,
 				OutputFile:    outputPath,
 				DateFormatted: dateFormatted,
+				templates:     templates,
 			}
 			site.Pages = append(site.Pages, page)
+			// Changing a page's defaults changes the page
+			cache.addSource(page, append(content, defaultsSource...))
 
 			for _, tag := range frontmatter.Tags {
 				site.PagesByTag[tag] = append(site.PagesByTag[tag], page)
@@ -174,101 +356,246 @@ func main() {
 			return fmt.Errorf("Templates field is missing in frontmatter in file %s", page.Path)
 		}
 
+		page.parse()
+		if page.parseErr != nil {
+			return page.parseErr
+		}
+
 		// First template in frontmatter should be the base template.
 		baseTemplate := filepath.Base(page.Frontmatter.Templates[0])
 
-		templatePaths := make([]string, len(page.Frontmatter.Templates))
-		for i, path := range page.Frontmatter.Templates {
-			templatePaths[i] = filepath.Join(rootDir, path)
-		}
-
-		tmpl, err := template.New("").Funcs(template.FuncMap{
-			"Now":     now,
-			"Include": makeIncludeFunc(page.Path, page),
-		}).ParseFiles(templatePaths...)
+		tmpl, err := templates.pageTemplate(page)
 		if err != nil {
-			return fmt.Errorf("Error parsing templates in file %s: %w", page.Path, err)
-		}
-
-		extensions := parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock | parser.Attributes
-		p := parser.NewWithExtensions(extensions)
-
-		doc := markdown.Parse([]byte(page.Markdown), p)
-
-		opts := html.RendererOptions{
-			Flags: html.CommonFlags,
+			return err
 		}
-		renderer := html.NewRenderer(opts)
-		htmlContent := markdown.Render(doc, renderer)
-		page.Content = string(htmlContent)
 
 		var htmlBuffer strings.Builder
 		if err := tmpl.ExecuteTemplate(&htmlBuffer, baseTemplate, page); err != nil {
 			return fmt.Errorf("Error rendering Markdown in file %s: %w", page.Path, err)
 		}
 
+		if err := os.MkdirAll(filepath.Dir(page.OutputFile), 0755); err != nil {
+			return fmt.Errorf("Error creating directory for HTML file %s: %w", page.OutputFile, err)
+		}
+
 		err = ioutil.WriteFile(page.OutputFile, []byte(htmlBuffer.String()), 0644)
 		if err != nil {
 			return fmt.Errorf("Error writing HTML file %s: %w", page.OutputFile, err)
 		}
 
-		fmt.Printf("Converted %s to %s\n", page.Path, page.OutputFile)
-
 		return nil
 	}
 
+	if opts.outDir != "" && !opts.check {
+		if err := prepareOutputDir(rootDir, opts.outDir, opts.force || !cache.hasPrevious()); err != nil {
+			return fmt.Errorf("Error preparing output directory: %w", err)
+		}
+	}
+
 	// Process markdown files and populate Site object
 	err = filepath.Walk(rootDir, processMarkdownFile)
 	if err != nil {
-		log.Fatalf("Error processing markdown files: %v", err)
+		return fmt.Errorf("Error processing markdown files: %w", err)
 	}
 
-	// Sort PagesByTag by Date
+	// Sort PagesByTag by Date, keeping pages with the same date in walk
+	// order so listings and feeds are stable between builds
 	for _, pages := range site.PagesByTag {
 		p := pages
-		sort.Slice(p, func(i, j int) bool {
+		sort.SliceStable(p, func(i, j int) bool {
 			return p[i].Date.After(p[j].Date)
 		})
 	}
 
-	// Render markdown files to HTML
+	// Generate a page for every tag plus an overview listing all of them
+	site.Tags = collectTags(site.PagesByTag)
+	if len(config.Taxonomy.Templates) > 0 {
+		tagPages, err := taxonomyPages(site, rootDir, config.Taxonomy, locatePage)
+		if err != nil {
+			return fmt.Errorf("Error generating tag pages: %w", err)
+		}
+		site.Pages = append(site.Pages, tagPages...)
+	}
+
+	configureFeeds(site, config.Feeds, locatePage)
+
+	if opts.check {
+		outputRoot := rootDir
+		if opts.outDir != "" {
+			outputRoot = opts.outDir
+		}
+
+		broken, err := checkLinks(site, outputRoot)
+		if err != nil {
+			return fmt.Errorf("Error checking links: %w", err)
+		}
+		if len(broken) > 0 {
+			log.Printf("Found %d broken links:", len(broken))
+			for _, b := range broken {
+				log.Printf("  %s", b)
+			}
+			return errBuildFailed
+		}
+
+		fmt.Printf("Checked links in %d pages\n", len(site.Pages))
+		return nil
+	}
+
+	// Parse every template up front so broken ones are reported even when
+	// no page uses them
+	failed := append(frontmatterErrs, templates.checkAll(config.Templates)...)
+
+	// Find pages whose inputs changed since the last build. Pages whose
+	// templates can't be hashed are rendered so the error gets reported.
+	stale := []*Page{}
+	for _, page := range site.Pages {
+		key, err := cache.pageKey(page, cache.previousIncludes(page))
+		if err == nil && cache.isFresh(page, key) {
+			cache.record(page, key, cache.previousIncludes(page))
+			continue
+		}
+		stale = append(stale, page)
+	}
+
+	// Expand shortcodes one page at a time before rendering in parallel,
+	// see Page.expand
 	for _, page := range site.Pages {
-		err := renderPage(page)
+		page.expand()
+	}
+
+	// Render markdown files to HTML
+	renderErrs := renderPages(stale, opts.jobs, renderPage)
+
+	for i, page := range stale {
+		if err := renderErrs[i]; err != nil {
+			failed = append(failed, err)
+			continue
+		}
+
+		fmt.Printf("Converted %s to %s\n", page.Path, page.OutputFile)
+
+		key, err := cache.pageKey(page, page.includes)
 		if err != nil {
-			log.Fatalf("Error rendering page: %v", err)
+			failed = append(failed, err)
+			continue
+		}
+		cache.record(page, key, page.includes)
+	}
+
+	if skipped := len(site.Pages) - len(stale); skipped > 0 {
+		fmt.Printf("Skipped %d unchanged pages\n", skipped)
+	}
+
+	if err := cache.prune(site.Pages); err != nil {
+		return fmt.Errorf("Error removing stale outputs: %w", err)
+	}
+
+	if err := writeFeeds(site, rootDir, locatePage); err != nil {
+		failed = append(failed, err)
+	}
+
+	if err := writeSitemap(site, rootDir, config, locatePage); err != nil {
+		failed = append(failed, err)
+	}
+
+	if err := cache.save(); err != nil {
+		return fmt.Errorf("Error saving build cache: %w", err)
+	}
+
+	if opts.outDir != "" {
+		if err := copyStaticFiles(rootDir, opts.outDir, config.Static); err != nil {
+			return fmt.Errorf("Error copying static files: %w", err)
+		}
+
+		manifestPath, _ := locatePage(config.AssetManifest)
+		if err := templates.assets.write(opts.outDir, manifestPath); err != nil {
+			return fmt.Errorf("Error writing assets: %w", err)
 		}
 	}
+
+	if len(failed) > 0 {
+		log.Printf("Build failed with %d errors:", len(failed))
+		for _, err := range failed {
+			log.Printf("  %v", err)
+		}
+		return errBuildFailed
+	}
+
+	return nil
 }
 
-func now() time.Time {
-	return time.Now()
+// Content returns the page's markdown rendered to HTML.
+func (p *Page) Content() string {
+	p.parse()
+	return p.content
 }
 
-func makeIncludeFunc(path string, page *Page) func(string) (string, error) {
-	return func(filename string) (string, error) {
-		currentDir := filepath.Dir(path)
-		includeFilePath := filepath.Join(currentDir, filename)
+// TOC returns the page's headings, nested by level.
+func (p *Page) TOC() []*Heading {
+	p.parse()
+	return p.toc
+}
 
-		includeContent, err := ioutil.ReadFile(includeFilePath)
-		if err != nil {
-			return "", fmt.Errorf("Error reading included file %s: %w", includeFilePath, err)
+// markdownExtensions are the markdown features enabled for pages and the
+// markdownify template function.
+const markdownExtensions = parser.CommonExtensions | parser.AutoHeadingIDs | parser.NoEmptyLineBeforeBlock | parser.Attributes
+
+// expand runs the shortcodes in the page's markdown once. Shortcodes can read
+// the content of any page, which expands that page's shortcodes in turn, so
+// builds expand every page one at a time before rendering: a page reached
+// again while its own shortcodes run is then a cycle on this goroutine, and
+// parse reports it rather than waiting on itself forever.
+func (p *Page) expand() {
+	p.expandOnce.Do(func() {
+		p.source = p.Markdown
+		if p.templates == nil {
+			return
 		}
 
-		tmpl, err := template.New("include").Funcs(template.FuncMap{
-			"Now":     now,
-			"Include": makeIncludeFunc(includeFilePath, page),
-		}).Parse(string(includeContent))
+		p.expanding.Store(true)
+		defer p.expanding.Store(false)
+
+		expanded, err := p.templates.expandShortcodes(p, p.Markdown)
 		if err != nil {
-			return "", fmt.Errorf("Error parsing included file %s: %w", includeFilePath, err)
+			p.parseErr = fmt.Errorf("Error expanding shortcodes in file %s: %w", p.Path, err)
+			return
 		}
+		p.source = expanded
+	})
+}
 
-		var includeBuffer strings.Builder
-		if err := tmpl.Execute(&includeBuffer, page); err != nil {
-			return "", fmt.Errorf("Error rendering included file %s: %w", includeFilePath, err)
+// parse converts the page's markdown on first use, so pages skipped by the
+// build cache are only parsed when another page lists them. It's safe to
+// call from concurrent renders once every page is expanded. Reading a page
+// from its own shortcodes panics, which templates return as an error.
+func (p *Page) parse() {
+	if p.expanding.Load() {
+		panic(fmt.Errorf("%s is still expanding its shortcodes, so they can't read its content", p.Path))
+	}
+	p.expand()
+
+	p.parseOnce.Do(func() {
+		if p.parseErr != nil {
+			return
 		}
 
-		return includeBuffer.String(), nil
-	}
+		doc := markdown.Parse([]byte(p.source), parser.NewWithExtensions(markdownExtensions))
+
+		opts := html.RendererOptions{
+			Flags: html.CommonFlags,
+		}
+		p.content = string(markdown.Render(doc, html.NewRenderer(opts)))
+		p.toc = buildTOC(doc)
+		p.wordCount = len(strings.Fields(plainText(p.content)))
+
+		if para := firstParagraph(doc); para != nil {
+			p.firstParagraph = string(markdown.Render(para, html.NewRenderer(opts)))
+		}
+	})
+}
+
+func now() time.Time {
+	return time.Now()
 }
 
 func getCurrentGitSHA(dir string) (string, error) {
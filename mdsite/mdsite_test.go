@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildDraftsAndFuturePages(t *testing.T) {
+	files := map[string]string{
+		configFileName: "title: Test\nauthor: Tester\nurl: https://example.com\ntemplates: [templates/*]\n" +
+			"feeds:\n  - tag: post\n    rss: rss.xml\n",
+		"templates/base.html": `{{ .Title }}`,
+		"templates/list.html": `{{ range .Site.PagesByTag.post }}[{{ .Title }}]{{ end }}`,
+		"index.md":            "---\ntitle: Home\ntemplates: [templates/list.html]\n---\n",
+		"published.md":        "---\ntitle: Published\ndate: 2020-01-01\ntags: [post]\ntemplates: [templates/base.html]\n---\n",
+		"draft.md":            "---\ntitle: Draft\ndate: 2020-01-02\ndraft: true\ntags: [post]\ntemplates: [templates/base.html]\n---\n",
+		"future.md":           "---\ntitle: Future\ndate: 2999-01-01\ntags: [post]\ntemplates: [templates/base.html]\n---\n",
+	}
+
+	tests := []struct {
+		name string
+		opts buildOptions
+		want []string
+	}{
+		{"default", buildOptions{}, []string{"Published"}},
+		{"drafts", buildOptions{drafts: true}, []string{"Draft", "Published"}},
+		{"future", buildOptions{future: true}, []string{"Future", "Published"}},
+		{"drafts and future", buildOptions{drafts: true, future: true}, []string{"Future", "Draft", "Published"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := newTestSite(t, files)
+			tt.opts.jobs = 2
+			if err := build(rootDir, tt.opts); err != nil {
+				t.Fatal(err)
+			}
+
+			included := map[string]bool{}
+			for _, title := range tt.want {
+				included[title] = true
+			}
+			for _, title := range []string{"Published", "Draft", "Future"} {
+				_, err := os.Stat(filepath.Join(rootDir, strings.ToLower(title)+".html"))
+				if exists := err == nil; exists != included[title] {
+					t.Errorf("%s written = %t, want %t", title, exists, included[title])
+				}
+			}
+
+			// Listings and feeds only show the pages that were built, newest first
+			index, err := ioutil.ReadFile(filepath.Join(rootDir, "index.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "[" + strings.Join(tt.want, "][") + "]"; string(index) != want {
+				t.Errorf("index.html = %q, want %q", index, want)
+			}
+
+			rss, err := ioutil.ReadFile(filepath.Join(rootDir, "rss.xml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, title := range []string{"Published", "Draft", "Future"} {
+				if listed := strings.Contains(string(rss), "<title>"+title+"</title>"); listed != included[title] {
+					t.Errorf("rss.xml lists %s = %t, want %t", title, listed, included[title])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// blogPosting is the schema.org BlogPosting described by a page's JSON-LD.
+type blogPosting struct {
+	Context       string       `json:"@context"`
+	Type          string       `json:"@type"`
+	Headline      string       `json:"headline"`
+	Description   string       `json:"description,omitempty"`
+	URL           string       `json:"url"`
+	MainEntity    string       `json:"mainEntityOfPage"`
+	Image         string       `json:"image,omitempty"`
+	DatePublished string       `json:"datePublished"`
+	DateModified  string       `json:"dateModified"`
+	Keywords      []string     `json:"keywords,omitempty"`
+	Author        schemaPerson `json:"author"`
+}
+
+type schemaPerson struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+// Meta returns the canonical link, Open Graph and Twitter Card tags for the
+// page, and BlogPosting JSON-LD when it's a dated article, ready to place in
+// the head of its template.
+func (p *Page) Meta() string {
+	site := p.Site
+
+	title := site.Title
+	if p.Title != "" {
+		title = p.Title
+	}
+	description := p.Summary()
+	if description == "" {
+		description = site.Description
+	}
+	image := ""
+	if p.Image != "" {
+		image = absoluteURL(p.URL, p.Image)
+	}
+	article := !p.Date.IsZero()
+
+	var b strings.Builder
+	link := func(rel, href string) {
+		fmt.Fprintf(&b, "<link rel=\"%s\" href=\"%s\">\n", rel, html.EscapeString(href))
+	}
+	meta := func(attr, key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "<meta %s=\"%s\" content=\"%s\">\n", attr, key, html.EscapeString(value))
+		}
+	}
+
+	link("canonical", p.URL)
+	meta("name", "description", description)
+
+	ogType := "website"
+	if article {
+		ogType = "article"
+	}
+	meta("property", "og:type", ogType)
+	meta("property", "og:site_name", site.Title)
+	meta("property", "og:title", title)
+	meta("property", "og:description", description)
+	meta("property", "og:url", p.URL)
+	meta("property", "og:image", image)
+	if article {
+		meta("property", "article:published_time", p.Date.Format(time.RFC3339))
+		if !p.Updated.IsZero() {
+			meta("property", "article:modified_time", p.Updated.Format(time.RFC3339))
+		}
+		meta("property", "article:author", site.Author)
+		for _, tag := range p.Tags {
+			meta("property", "article:tag", tag)
+		}
+	}
+
+	card := "summary"
+	if image != "" {
+		card = "summary_large_image"
+	}
+	meta("name", "twitter:card", card)
+	meta("name", "twitter:title", title)
+	meta("name", "twitter:description", description)
+	meta("name", "twitter:image", image)
+
+	if article {
+		modified := p.Updated
+		if modified.IsZero() {
+			modified = p.Date
+		}
+		posting := blogPosting{
+			Context:       "https://schema.org",
+			Type:          "BlogPosting",
+			Headline:      title,
+			Description:   description,
+			URL:           p.URL,
+			MainEntity:    p.URL,
+			Image:         image,
+			DatePublished: p.Date.Format(time.RFC3339),
+			DateModified:  modified.Format(time.RFC3339),
+			Keywords:      p.Tags,
+			Author:        schemaPerson{Type: "Person", Name: site.Author},
+		}
+		// json.Marshal escapes <, > and &, so the content can't close the
+		// script element
+		if content, err := json.Marshal(posting); err == nil {
+			fmt.Fprintf(&b, "<script type=\"application/ld+json\">%s</script>\n", content)
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
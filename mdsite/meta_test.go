@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPageMeta(t *testing.T) {
+	site := &Site{Title: "Site", Author: "Author", Description: "Site description"}
+	page := &Page{
+		Site: site,
+		URL:  "https://example.com/post/",
+		Frontmatter: &Frontmatter{
+			Title:   `Tips & "tricks"`,
+			Summary: "A <b>bold</b> summary",
+			Date:    time.Date(2024, 1, 29, 0, 0, 0, 0, time.UTC),
+			Image:   "preview.png",
+			Tags:    []string{"post"},
+		},
+	}
+
+	meta := page.Meta()
+	for _, want := range []string{
+		`<link rel="canonical" href="https://example.com/post/">`,
+		`<meta property="og:title" content="Tips &amp; &#34;tricks&#34;">`,
+		`<meta property="og:description" content="A &lt;b&gt;bold&lt;/b&gt; summary">`,
+		`<meta property="og:image" content="https://example.com/post/preview.png">`,
+		`<meta property="og:type" content="article">`,
+		`<meta name="twitter:card" content="summary_large_image">`,
+		`"@type":"BlogPosting"`,
+		`"description":"A \u003cb\u003ebold\u003c/b\u003e summary"`,
+	} {
+		if !strings.Contains(meta, want) {
+			t.Errorf("Meta() is missing %s in:\n%s", want, meta)
+		}
+	}
+
+	page = &Page{Site: site, URL: "https://example.com/", Frontmatter: &Frontmatter{}}
+	meta = page.Meta()
+	for _, want := range []string{
+		`<meta property="og:type" content="website">`,
+		`<meta property="og:title" content="Site">`,
+		`<meta name="description" content="Site description">`,
+		`<meta name="twitter:card" content="summary">`,
+	} {
+		if !strings.Contains(meta, want) {
+			t.Errorf("Meta() is missing %s in:\n%s", want, meta)
+		}
+	}
+	if strings.Contains(meta, "ld+json") {
+		t.Errorf("Meta() of an undated page has JSON-LD:\n%s", meta)
+	}
+}
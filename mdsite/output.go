@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// prepareOutputDir creates outDir, first emptying it when clean is set so
+// files from an unknown previous build are never deployed. It refuses to
+// touch a directory that contains the site sources, and to empty one that
+// has files but no build manifest, since mdsite didn't create it.
+func prepareOutputDir(rootDir, outDir string, clean bool) error {
+	if isWithinDir(rootDir, outDir) {
+		return fmt.Errorf("Output directory %s must not contain the site root %s", outDir, rootDir)
+	}
+
+	if clean {
+		entries, err := ioutil.ReadDir(outDir)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Error reading output directory %s: %w", outDir, err)
+		}
+		if _, err := os.Stat(filepath.Join(outDir, manifestFileName)); len(entries) > 0 && os.IsNotExist(err) {
+			return fmt.Errorf("Output directory %s is not empty and wasn't built by mdsite, remove it or choose another", outDir)
+		}
+		if err := os.RemoveAll(outDir); err != nil {
+			return fmt.Errorf("Error cleaning output directory %s: %w", outDir, err)
+		}
+	}
+	return os.MkdirAll(outDir, 0755)
+}
+
+// copyStaticFiles copies every file under rootDir whose slash-separated path
+// relative to rootDir matches one of patterns into the same place in outDir.
+func copyStaticFiles(rootDir, outDir string, patterns []string) error {
+	return filepath.Walk(rootDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("Error accessing file %s: %w", filePath, err)
+		}
+
+		if info.IsDir() {
+			if isSkippedDir(filePath) || isWithinDir(filePath, outDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(rootDir, filePath)
+		if err != nil {
+			return err
+		}
+
+		if !matchesAny(filepath.ToSlash(relPath), patterns) {
+			return nil
+		}
+
+		return copyFile(filePath, filepath.Join(outDir, relPath))
+	})
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("Error reading file %s: %w", src, err)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("Error writing file %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("Error copying %s to %s: %w", src, dst, err)
+	}
+
+	return out.Close()
+}
+
+func matchesAny(relPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isSkippedDir reports whether the walk should ignore the directory at path.
+func isSkippedDir(path string) bool {
+	return strings.Contains(path, "node_modules") || filepath.Base(path) == ".git"
+}
+
+// isWithinDir reports whether path is dir or one of its descendants.
+func isWithinDir(path, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
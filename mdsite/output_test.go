@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPrepareOutputDir(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		clean   bool
+		wantErr bool
+		// Whether old.html is left in place
+		wantKept bool
+	}{
+		{"missing", nil, true, false, false},
+		{"previous build", map[string]string{manifestFileName: "{}", "old.html": ""}, true, false, false},
+		{"not cleaned", map[string]string{"old.html": ""}, false, false, true},
+		{"foreign files", map[string]string{"old.html": ""}, true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootDir := writeFiles(t, map[string]string{"index.md": ""})
+			outDir := filepath.Join(t.TempDir(), "public")
+			for name, text := range tt.files {
+				if err := os.MkdirAll(outDir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(outDir, name), []byte(text), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := prepareOutputDir(rootDir, outDir, tt.clean)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prepareOutputDir error = %v, want error %t", err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(outDir, "old.html")); (err == nil) != tt.wantKept {
+				t.Errorf("old.html kept = %t, want %t", err == nil, tt.wantKept)
+			}
+			if info, err := os.Stat(outDir); err != nil || !info.IsDir() {
+				t.Errorf("output directory missing: %v", err)
+			}
+		})
+	}
+
+	rootDir := writeFiles(t, map[string]string{"index.md": ""})
+	if err := prepareOutputDir(filepath.Join(rootDir, "site"), rootDir, true); err == nil {
+		t.Error("prepareOutputDir accepted an output directory containing the site root")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import "sort"
+
+// Related returns up to limit other pages sharing a tag with this one, those
+// with the most tags in common first and then the most recent.
+func (p *Page) Related(limit int) []*Page {
+	tags := map[string]bool{}
+	for _, tag := range p.Tags {
+		tags[tag] = true
+	}
+
+	type candidate struct {
+		page   *Page
+		shared int
+	}
+	candidates := []candidate{}
+	for _, other := range p.Site.Pages {
+		if other == p {
+			continue
+		}
+		shared := 0
+		for _, tag := range other.Tags {
+			if tags[tag] {
+				shared++
+			}
+		}
+		if shared > 0 {
+			candidates = append(candidates, candidate{other, shared})
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].shared != candidates[j].shared {
+			return candidates[i].shared > candidates[j].shared
+		}
+		return candidates[i].page.Date.After(candidates[j].page.Date)
+	})
+
+	related := []*Page{}
+	for _, c := range candidates {
+		if limit > 0 && len(related) == limit {
+			break
+		}
+		related = append(related, c.page)
+	}
+	return related
+}
+
+// Prev returns the page with tag dated just before this one, or nil.
+func (p *Page) Prev(tag string) *Page {
+	return p.neighbour(tag, 1)
+}
+
+// Next returns the page with tag dated just after this one, or nil.
+func (p *Page) Next(tag string) *Page {
+	return p.neighbour(tag, -1)
+}
+
+// neighbour returns the page offset places away in the tag's list, which is
+// sorted newest first.
+func (p *Page) neighbour(tag string, offset int) *Page {
+	pages := p.Site.PagesByTag[tag]
+	for i, other := range pages {
+		if other != p {
+			continue
+		}
+		if j := i + offset; j >= 0 && j < len(pages) {
+			return pages[j]
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelatedAndNeighbours(t *testing.T) {
+	site := &Site{PagesByTag: map[string][]*Page{}}
+	newPage := func(title string, day int, tags ...string) *Page {
+		p := &Page{Site: site, Frontmatter: &Frontmatter{
+			Title: title,
+			Date:  time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC),
+			Tags:  tags,
+		}}
+		site.Pages = append(site.Pages, p)
+		return p
+	}
+
+	a := newPage("a", 1, "post", "go")
+	b := newPage("b", 2, "post")
+	c := newPage("c", 3, "post", "go")
+	d := newPage("d", 4, "post")
+	newPage("e", 5, "other")
+
+	// Newest first, as main sorts them
+	site.PagesByTag["post"] = []*Page{d, c, b, a}
+
+	titles := func(pages []*Page) []string {
+		names := []string{}
+		for _, p := range pages {
+			names = append(names, p.Title)
+		}
+		return names
+	}
+
+	if got := titles(a.Related(0)); len(got) != 3 || got[0] != "c" || got[1] != "d" || got[2] != "b" {
+		t.Errorf("a.Related(0) = %v, want [c d b]", got)
+	}
+	if got := titles(a.Related(2)); len(got) != 2 {
+		t.Errorf("a.Related(2) = %v, want 2 pages", got)
+	}
+
+	if got := b.Prev("post"); got != a {
+		t.Errorf("b.Prev = %v, want a", got)
+	}
+	if got := b.Next("post"); got != c {
+		t.Errorf("b.Next = %v, want c", got)
+	}
+	if got := a.Prev("post"); got != nil {
+		t.Errorf("a.Prev = %v, want nil", got)
+	}
+	if got := d.Next("post"); got != nil {
+		t.Errorf("d.Next = %v, want nil", got)
+	}
+	if got := a.Next("other"); got != nil {
+		t.Errorf("a.Next in a tag it doesn't have = %v, want nil", got)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "sync"
+
+// renderPages calls render for every page using at most jobs goroutines and
+// returns each page's error at the same index as the page.
+func renderPages(pages []*Page, jobs int, render func(*Page) error) []error {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	errs := make([]error, len(pages))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = render(pages[i])
+			}
+		}()
+	}
+
+	for i := range pages {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
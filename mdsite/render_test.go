@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderPagesKeepsPageOrder(t *testing.T) {
+	pages := []*Page{}
+	for i := 0; i < 20; i++ {
+		pages = append(pages, &Page{Path: fmt.Sprintf("page%02d.md", i)})
+	}
+
+	// Later pages finish first, and every third one fails
+	render := func(page *Page) error {
+		var i int
+		fmt.Sscanf(page.Path, "page%02d.md", &i)
+		time.Sleep(time.Duration(len(pages)-i) * time.Millisecond)
+		if i%3 == 0 {
+			return errors.New(page.Path)
+		}
+		return nil
+	}
+
+	for _, jobs := range []int{0, 1, 4, 32} {
+		errs := renderPages(pages, jobs, render)
+		if len(errs) != len(pages) {
+			t.Fatalf("renderPages(jobs %d) returned %d errors for %d pages", jobs, len(errs), len(pages))
+		}
+		for i, err := range errs {
+			if (err != nil) != (i%3 == 0) || (err != nil && err.Error() != pages[i].Path) {
+				t.Errorf("renderPages(jobs %d) error %d = %v", jobs, i, err)
+			}
+		}
+	}
+}
+
+func TestBuildReportsEveryFailingPage(t *testing.T) {
+	files := map[string]string{
+		configFileName:          "title: Test\nauthor: Tester\nurl: https://example.com\ntemplates: [templates/*]\n",
+		"templates/base.html":   `{{ .Title }}`,
+		"templates/broken.html": `{{ .Title.Missing }}`,
+	}
+	failing := []string{}
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("page%d.md", i)
+		tmpl := "templates/base.html"
+		if i%2 == 1 {
+			tmpl = "templates/broken.html"
+			failing = append(failing, name)
+		}
+		files[name] = fmt.Sprintf("---\ntitle: Page %d\ntemplates: [%s]\n---\n", i, tmpl)
+	}
+	rootDir := newTestSite(t, files)
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	if err := build(rootDir, buildOptions{jobs: 4}); err != errBuildFailed {
+		t.Fatalf("build error = %v, want %v", err, errBuildFailed)
+	}
+
+	reported := []string{}
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if i := strings.Index(line, "Error rendering Markdown in file "); i >= 0 {
+			path := strings.TrimPrefix(line[i:], "Error rendering Markdown in file ")
+			reported = append(reported, filepath.Base(path[:strings.Index(path, ":")]))
+		}
+	}
+	if strings.Join(reported, " ") != strings.Join(failing, " ") {
+		t.Errorf("build reported %v, want %v in page order\n%s", reported, failing, logs.String())
+	}
+	if !strings.Contains(logs.String(), fmt.Sprintf("Build failed with %d errors", len(failing))) {
+		t.Errorf("build logged %q, want a count of %d errors", logs.String(), len(failing))
+	}
+
+	for i := 0; i < 8; i += 2 {
+		if _, err := os.Stat(filepath.Join(rootDir, fmt.Sprintf("page%d.html", i))); err != nil {
+			t.Errorf("page%d.html wasn't written: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shortcodeDir holds the template for each shortcode, named after it, such
+// as shortcodes/figure.html.
+const shortcodeDir = "shortcodes"
+
+var (
+	// shortcodeTagPattern matches an opening {{< name key="value" >}}, a
+	// closing {{< /name >}}, or an escaped {{</* name */>}} that is output
+	// as written.
+	shortcodeTagPattern = regexp.MustCompile(`(?s)\{\{<(/\*.*?\*/|.*?)>\}\}`)
+
+	shortcodeNamePattern  = regexp.MustCompile(`^\s*(/?)\s*([\w-]+)`)
+	shortcodeParamPattern = regexp.MustCompile(`^\s*([\w-]+)\s*=\s*(?:("(?:[^"\\]|\\.)*")|'([^']*)'|([^\s"'/]+))`)
+)
+
+// Shortcode is the data a shortcode template is executed with.
+type Shortcode struct {
+	Name   string
+	Params map[string]string
+	// Markdown between the opening and closing tags, with nested shortcodes
+	// already expanded. Empty for shortcodes without a closing tag.
+	Inner string
+	Page  *Page
+}
+
+type shortcodeTag struct {
+	start, end int
+	name       string
+	params     map[string]string
+	closing    bool
+	// Set for {{< name />}}, which never takes a closing tag
+	selfClosing bool
+	// Literal text for an escaped tag
+	escaped string
+}
+
+// expandShortcodes replaces the shortcodes in markdown with the output of
+// their templates. A shortcode whose closing tag follows gets the markdown in
+// between as its inner content.
+func (r *templateRegistry) expandShortcodes(page *Page, markdown string) (string, error) {
+	tags, err := parseShortcodeTags(markdown)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	pos := 0
+	for i := 0; i < len(tags); i++ {
+		tag := tags[i]
+		b.WriteString(markdown[pos:tag.start])
+		pos = tag.end
+
+		if tag.escaped != "" {
+			b.WriteString(tag.escaped)
+			continue
+		}
+		if tag.closing {
+			return "", fmt.Errorf("Closing shortcode %q has no opening tag", tag.name)
+		}
+
+		shortcode := &Shortcode{Name: tag.name, Params: tag.params, Page: page}
+		if j := matchingShortcodeTag(tags, i); j >= 0 && !tag.selfClosing {
+			inner, err := r.expandShortcodes(page, markdown[tag.end:tags[j].start])
+			if err != nil {
+				return "", err
+			}
+			shortcode.Inner = inner
+			pos = tags[j].end
+			i = j
+		}
+
+		output, err := r.renderShortcode(shortcode)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(output)
+	}
+	b.WriteString(markdown[pos:])
+
+	return b.String(), nil
+}
+
+// renderShortcode executes the template for a shortcode. The template counts
+// as an include of the page, so the page is rebuilt when it changes.
+func (r *templateRegistry) renderShortcode(shortcode *Shortcode) (string, error) {
+	filePath := filepath.Join(r.rootDir, shortcodeDir, shortcode.Name+".html")
+	page := shortcode.Page
+	page.includes = append(page.includes, filePath)
+
+	parsed, err := r.file(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("Unknown shortcode %q, expected a template at %s", shortcode.Name, filePath)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := parsed.Clone()
+	if err != nil {
+		return "", fmt.Errorf("Error parsing shortcode %s: %w", filePath, err)
+	}
+	tmpl.Funcs(r.pageFuncs(filePath, page))
+	// Parameters left out are empty rather than "<no value>"
+	tmpl.Option("missingkey=zero")
+
+	var output strings.Builder
+	if err := tmpl.Execute(&output, shortcode); err != nil {
+		return "", fmt.Errorf("Error rendering shortcode %s: %w", filePath, err)
+	}
+	return output.String(), nil
+}
+
+// parseShortcodeTags finds every shortcode tag in markdown, in order.
+func parseShortcodeTags(markdown string) ([]shortcodeTag, error) {
+	tags := []shortcodeTag{}
+	for _, m := range shortcodeTagPattern.FindAllStringSubmatchIndex(markdown, -1) {
+		tag := shortcodeTag{start: m[0], end: m[1]}
+		body := markdown[m[2]:m[3]]
+
+		if strings.HasPrefix(body, "/*") {
+			tag.escaped = "{{<" + strings.TrimSuffix(strings.TrimPrefix(body, "/*"), "*/") + ">}}"
+			tags = append(tags, tag)
+			continue
+		}
+
+		name := shortcodeNamePattern.FindStringSubmatch(body)
+		if name == nil {
+			return nil, fmt.Errorf("Invalid shortcode %q", markdown[m[0]:m[1]])
+		}
+		tag.closing = name[1] == "/"
+		tag.name = name[2]
+		tag.params = map[string]string{}
+
+		rest := body[len(name[0]):]
+		for {
+			param := shortcodeParamPattern.FindStringSubmatch(rest)
+			if param == nil {
+				break
+			}
+			value := param[3] + param[4]
+			if param[2] != "" {
+				var err error
+				if value, err = strconv.Unquote(param[2]); err != nil {
+					return nil, fmt.Errorf("Invalid value for %s in shortcode %q: %w", param[1], markdown[m[0]:m[1]], err)
+				}
+			}
+			tag.params[param[1]] = value
+			rest = rest[len(param[0]):]
+		}
+		rest = strings.TrimSpace(rest)
+		if rest == "/" && !tag.closing {
+			tag.selfClosing = true
+			rest = ""
+		}
+		if rest != "" || (tag.closing && len(tag.params) > 0) {
+			return nil, fmt.Errorf("Invalid shortcode %q", markdown[m[0]:m[1]])
+		}
+
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// shortcodeNames returns the names of the shortcodes used in markdown,
+// sorted and without duplicates. Markdown with malformed tags uses none.
+func shortcodeNames(markdown string) []string {
+	tags, err := parseShortcodeTags(markdown)
+	if err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	names := []string{}
+	for _, tag := range tags {
+		if tag.escaped != "" || tag.closing || seen[tag.name] {
+			continue
+		}
+		seen[tag.name] = true
+		names = append(names, tag.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// matchingShortcodeTag returns the index of the tag closing tags[i], or -1
+// when it has none.
+func matchingShortcodeTag(tags []shortcodeTag, i int) int {
+	depth := 0
+	for j := i + 1; j < len(tags); j++ {
+		if tags[j].escaped != "" || tags[j].name != tags[i].name {
+			continue
+		}
+		if tags[j].selfClosing {
+			continue
+		}
+		if !tags[j].closing {
+			depth++
+			continue
+		}
+		if depth == 0 {
+			return j
+		}
+		depth--
+	}
+	return -1
+}
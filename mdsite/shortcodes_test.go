@@ -0,0 +1,98 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpandShortcodes(t *testing.T) {
+	rootDir := writeFiles(t, map[string]string{
+		"shortcodes/figure.html": `<img src="{{ .Params.src }}" alt="{{ .Params.caption }}">`,
+		"shortcodes/note.html":   `<aside class="{{ .Params.kind }}">{{ .Inner }}</aside>`,
+	})
+
+	tests := []struct {
+		markdown string
+		want     string
+	}{
+		{`{{< figure src="preview.png" caption="A \"quoted\" caption" >}}`, `<img src="preview.png" alt="A "quoted" caption">`},
+		{`{{<figure src=a.png caption='single'/>}}`, `<img src="a.png" alt="single">`},
+		{"{{< note kind=tip >}}\n*hi*\n{{< /note >}}", "<aside class=\"tip\">\n*hi*\n</aside>"},
+		{`{{< note >}}a{{< note >}}b{{< /note >}}c{{< /note >}}`, `<aside class="">a<aside class="">b</aside>c</aside>`},
+		{`{{< note >}}{{< figure src=x.png />}}{{< /note >}}`, `<aside class=""><img src="x.png" alt=""></aside>`},
+		{"`{{</* figure src=\"x.png\" */>}}`", "`{{< figure src=\"x.png\" >}}`"},
+	}
+
+	r := newTemplateRegistry(rootDir)
+	for _, test := range tests {
+		page := &Page{Path: filepath.Join(rootDir, "page.md")}
+		got, err := r.expandShortcodes(page, test.markdown)
+		if err != nil {
+			t.Errorf("expandShortcodes(%q) error: %v", test.markdown, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("expandShortcodes(%q) = %q, want %q", test.markdown, got, test.want)
+		}
+	}
+
+	for _, markdown := range []string{`{{< missing >}}`, `{{< /note >}}`, `{{< figure src= >}}`} {
+		page := &Page{Path: filepath.Join(rootDir, "page.md")}
+		if _, err := r.expandShortcodes(page, markdown); err == nil {
+			t.Errorf("expandShortcodes(%q) returned no error", markdown)
+		}
+	}
+}
+
+func TestShortcodesReadingPageContent(t *testing.T) {
+	rootDir := newTestSite(t, map[string]string{
+		configFileName:           "title: Test\nauthor: Tester\nurl: https://example.com\ntemplates: [templates/*, shortcodes/*]\n",
+		"templates/base.html":    `{{ .Content }}`,
+		"shortcodes/recent.html": `{{ range .Page.Site.PagesByTag.post }}<p>{{ .Title }}: {{ .Summary }}</p>{{ end }}`,
+		"shortcodes/other.html":  `{{ range .Page.Site.Pages }}{{ if eq .Title $.Params.title }}{{ .Summary }}{{ end }}{{ end }}`,
+		"_defaults.yaml":         "templates: [templates/base.html]\n",
+		"index.md":               "---\ntitle: Home\n---\n{{< recent />}}\n",
+		"one.md":                 "---\ntitle: One\ntags: [post]\nsummary: First\n---\nOne\n",
+		"two.md":                 "---\ntitle: Two\ntags: [post]\n---\nTwo\n\n{{< recent />}}\n",
+		"a.md":                   "---\ntitle: A\n---\n{{< other title=B />}}\n",
+		"b.md":                   "---\ntitle: B\n---\n{{< other title=A />}}\n",
+	})
+
+	var logs strings.Builder
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- build(rootDir, buildOptions{jobs: 4})
+	}()
+	select {
+	case err := <-done:
+		if err != errBuildFailed {
+			t.Fatalf("build error = %v, want %v", err, errBuildFailed)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("build deadlocked on shortcodes reading page content")
+	}
+
+	// Two lists itself, and B reads A while A's shortcode reads B
+	for _, file := range []string{"two.md", "a.md"} {
+		if want := filepath.Join(rootDir, file) + " is still expanding its shortcodes"; !strings.Contains(logs.String(), want) {
+			t.Errorf("build logged %q, want %q", logs.String(), want)
+		}
+	}
+
+	// Pages not in a cycle can list the content of others
+	index, err := ioutil.ReadFile(filepath.Join(rootDir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "<p>One: First</p>") {
+		t.Errorf("index.html = %s, want the summary of One", index)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// writeSitemap writes sitemap.xml listing every HTML page, and robots.txt
+// pointing crawlers at it, to the paths set in site.yaml.
+func writeSitemap(site *Site, rootDir string, config *Config, locatePage func(string) (string, string)) error {
+	if config.Sitemap == "" {
+		return nil
+	}
+
+	modTimes, err := getGitModTimes(rootDir)
+	if err != nil {
+		log.Printf("Warning: Not using git history for sitemap dates: %v", err)
+		modTimes = map[string]time.Time{}
+	}
+
+	urlSet := sitemapURLSet{URLs: []sitemapURL{}}
+	for _, page := range site.Pages {
+		if !inSitemap(page) {
+			continue
+		}
+
+		entry := sitemapURL{Loc: page.URL}
+		if lastMod := pageLastMod(page, rootDir, modTimes); !lastMod.IsZero() {
+			entry.LastMod = lastMod.UTC().Format("2006-01-02")
+		}
+		urlSet.URLs = append(urlSet.URLs, entry)
+	}
+	sort.Slice(urlSet.URLs, func(i, j int) bool {
+		return urlSet.URLs[i].Loc < urlSet.URLs[j].Loc
+	})
+
+	content, err := encodeXML(urlSet)
+	if err != nil {
+		return fmt.Errorf("Error encoding sitemap: %w", err)
+	}
+
+	sitemapPath, sitemapURL := locatePage(config.Sitemap)
+	if err := writeOutput(sitemapPath, content); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote sitemap %s\n", sitemapPath)
+
+	if config.Robots == "" {
+		return nil
+	}
+
+	robots := fmt.Sprintf("User-agent: *\nAllow: /\n\nSitemap: %s\n", sitemapURL)
+	robotsPath, _ := locatePage(config.Robots)
+	if err := writeOutput(robotsPath, []byte(robots)); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", robotsPath)
+
+	return nil
+}
+
+// inSitemap reports whether page belongs in the sitemap. Pages can opt out
+// with "sitemap: false" in their frontmatter, and non-HTML outputs such as
+// feeds and the 404 page are always left out.
+func inSitemap(page *Page) bool {
+	if page.Frontmatter.Sitemap != nil && !*page.Frontmatter.Sitemap {
+		return false
+	}
+	base := filepath.Base(page.OutputFile)
+	return filepath.Ext(base) == ".html" && base != "404.html"
+}
+
+// pageLastMod returns when page last changed: its updated date if set,
+// otherwise the later of its date and the last commit touching its source.
+// Generated tag pages change whenever their newest page does.
+func pageLastMod(page *Page, rootDir string, modTimes map[string]time.Time) time.Time {
+	if !page.Updated.IsZero() {
+		return page.Updated
+	}
+
+	lastMod := page.Date
+	if relPath, err := filepath.Rel(rootDir, page.Path); err == nil {
+		if t, ok := modTimes[filepath.ToSlash(relPath)]; ok && t.After(lastMod) {
+			lastMod = t
+		}
+	}
+
+	if page.Tag != nil {
+		for _, p := range page.Tag.Pages {
+			if t := pageLastMod(p, rootDir, modTimes); t.After(lastMod) {
+				lastMod = t
+			}
+		}
+	}
+
+	return lastMod
+}
+
+// getGitModTimes returns the time of the most recent commit touching each
+// file under dir, keyed by slash-separated path relative to dir. Shallow
+// clones are rejected since they'd date every file to the latest commit.
+func getGitModTimes(dir string) (map[string]time.Time, error) {
+	shallow := exec.Command("git", "rev-parse", "--is-shallow-repository")
+	shallow.Dir = dir
+	isShallow, err := shallow.Output()
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(string(isShallow)) == "true" {
+		return nil, fmt.Errorf("%s is a shallow clone, fetch its full history", dir)
+	}
+
+	cmd := exec.Command("git", "log", "--format=format:commit %cI", "--name-only", "--relative", "--", ".")
+	cmd.Dir = dir
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	modTimes := map[string]time.Time{}
+
+	// Commits are listed newest first, so the first time seen for a file is
+	// its most recent change
+	var current time.Time
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "commit ") {
+			t, err := time.Parse(time.RFC3339, strings.TrimPrefix(line, "commit "))
+			if err != nil {
+				return nil, err
+			}
+			current = t
+			continue
+		}
+		if _, ok := modTimes[line]; !ok {
+			modTimes[line] = current
+		}
+	}
+
+	return modTimes, scanner.Err()
+}
+
+func writeOutput(outputPath string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(outputPath, content, 0644); err != nil {
+		return fmt.Errorf("Error writing %s: %w", outputPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInSitemap(t *testing.T) {
+	no := false
+	yes := true
+
+	tests := []struct {
+		output  string
+		sitemap *bool
+		want    bool
+	}{
+		{"rings/index.html", nil, true},
+		{"rings/index.html", &yes, true},
+		{"resume/index.html", &no, false},
+		{"404.html", nil, false},
+		{"feed.xml", nil, false},
+	}
+
+	for _, tt := range tests {
+		page := &Page{OutputFile: tt.output, Frontmatter: &Frontmatter{Sitemap: tt.sitemap}}
+		if got := inSitemap(page); got != tt.want {
+			t.Errorf("inSitemap(%s, sitemap %v) = %t, want %t", tt.output, tt.sitemap, got, tt.want)
+		}
+	}
+}
+
+func TestPageLastMod(t *testing.T) {
+	rootDir := filepath.FromSlash("/site")
+	day := func(d int) time.Time { return time.Date(2023, 1, d, 0, 0, 0, 0, time.UTC) }
+	modTimes := map[string]time.Time{
+		"rings/index.md": day(10),
+		"yoto/index.md":  day(2),
+	}
+	page := func(relPath string, date, updated time.Time) *Page {
+		return &Page{
+			Path:        filepath.Join(rootDir, filepath.FromSlash(relPath)),
+			Frontmatter: &Frontmatter{Date: date, Updated: updated},
+		}
+	}
+
+	rings := page("rings/index.md", day(1), time.Time{})
+	yoto := page("yoto/index.md", day(5), time.Time{})
+	tests := []struct {
+		name string
+		page *Page
+		want time.Time
+	}{
+		{"later commit", rings, day(10)},
+		{"later date", yoto, day(5)},
+		{"updated", page("rings/index.md", day(1), day(3)), day(3)},
+		{"not in git", page("drafts/index.md", day(4), time.Time{}), day(4)},
+		{"undated and not in git", page("about.md", time.Time{}, time.Time{}), time.Time{}},
+		{"tag", &Page{Path: filepath.Join(rootDir, "tags", "post.md"), Frontmatter: &Frontmatter{}, Tag: &Tag{Pages: []*Page{yoto, rings}}}, day(10)},
+	}
+
+	for _, tt := range tests {
+		if got := pageLastMod(tt.page, rootDir, modTimes); !got.Equal(tt.want) {
+			t.Errorf("%s: pageLastMod = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWriteSitemap(t *testing.T) {
+	rootDir := newTestSite(t, map[string]string{
+		"rings/index.md": "---\ntitle: Rings\n---\n",
+		"resume.md":      "---\ntitle: Resume\nsitemap: false\n---\n",
+	})
+	outDir := t.TempDir()
+	locatePage := func(relPath string) (string, string) {
+		return filepath.Join(outDir, filepath.FromSlash(relPath)), "https://example.com/" + relPath
+	}
+
+	no := false
+	site := &Site{Pages: []*Page{
+		{Path: filepath.Join(rootDir, "rings", "index.md"), OutputFile: "rings/index.html", URL: "https://example.com/rings/", Frontmatter: &Frontmatter{}},
+		{Path: filepath.Join(rootDir, "resume.md"), OutputFile: "resume.html", URL: "https://example.com/resume.html", Frontmatter: &Frontmatter{Sitemap: &no}},
+	}}
+	config := &Config{Sitemap: "sitemap.xml", Robots: "robots.txt"}
+	if err := writeSitemap(site, rootDir, config, locatePage); err != nil {
+		t.Fatal(err)
+	}
+
+	sitemap, err := ioutil.ReadFile(filepath.Join(outDir, "sitemap.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	if want := "<loc>https://example.com/rings/</loc>\n    <lastmod>" + today + "</lastmod>"; !strings.Contains(string(sitemap), want) {
+		t.Errorf("sitemap.xml missing %q:\n%s", want, sitemap)
+	}
+	if strings.Contains(string(sitemap), "resume") {
+		t.Errorf("sitemap.xml lists a page with sitemap: false:\n%s", sitemap)
+	}
+
+	robots, err := ioutil.ReadFile(filepath.Join(outDir, "robots.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "User-agent: *\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n"; string(robots) != want {
+		t.Errorf("robots.txt = %q, want %q", robots, want)
+	}
+}
+
+func TestGetGitModTimesShallowClone(t *testing.T) {
+	rootDir := newTestSite(t, map[string]string{"index.md": "---\ntitle: Home\n---\n"})
+
+	modTimes, err := getGitModTimes(rootDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := modTimes["index.md"]; !ok {
+		t.Errorf("getGitModTimes = %v, want a time for index.md", modTimes)
+	}
+
+	cloneDir := filepath.Join(t.TempDir(), "clone")
+	if out, err := exec.Command("git", "clone", "-q", "--depth", "1", "file://"+filepath.ToSlash(rootDir), cloneDir).CombinedOutput(); err != nil {
+		t.Fatalf("git clone: %v\n%s", err, out)
+	}
+	if _, err := getGitModTimes(cloneDir); err == nil {
+		t.Error("getGitModTimes accepted a shallow clone")
+	}
+}
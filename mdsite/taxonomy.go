@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Tag is a tag along with the pages listing it, newest first.
+type Tag struct {
+	Name  string
+	Slug  string
+	URL   string
+	Pages []*Page
+}
+
+// TagURL returns the URL of the generated page for the named tag, or an empty
+// string when the tag has no page.
+func (s *Site) TagURL(name string) string {
+	for _, tag := range s.Tags {
+		if tag.Name == name {
+			return tag.URL
+		}
+	}
+	return ""
+}
+
+func collectTags(pagesByTag map[string][]*Page) []*Tag {
+	tags := []*Tag{}
+	for name, pages := range pagesByTag {
+		tags = append(tags, &Tag{
+			Name:  name,
+			Slug:  slugify(name),
+			Pages: pages,
+		})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags
+}
+
+// taxonomyPages creates a page for every tag in site.Tags and, when index
+// templates are configured, an overview page. It sets the URL of each tag
+// and site.TagsURL. Tags whose slugs are empty or shared with another tag are
+// an error, since their pages would overwrite the overview or each other.
+func taxonomyPages(site *Site, rootDir string, config TaxonomyConfig, locatePage func(string) (string, string)) ([]*Page, error) {
+	newPage := func(relPath string, frontmatter *Frontmatter) *Page {
+		outputPath, pageURL := locatePage(relPath)
+		path := filepath.Join(rootDir, relPath)
+		return &Page{
+			Site:        site,
+			Path:        path,
+			Dir:         filepath.Dir(path),
+			Frontmatter: frontmatter,
+			URL:         pageURL,
+			OutputFile:  outputPath,
+		}
+	}
+
+	pages := []*Page{}
+	slugs := map[string]*Tag{}
+	for _, tag := range site.Tags {
+		if tag.Slug == "" {
+			return nil, fmt.Errorf("Tag %q has no letters or digits to name its page with", tag.Name)
+		}
+		if other, ok := slugs[tag.Slug]; ok {
+			return nil, fmt.Errorf("Tags %q and %q would both be listed on the page for %q, rename one of them", other.Name, tag.Name, tag.Slug)
+		}
+		slugs[tag.Slug] = tag
+
+		page := newPage(filepath.Join(config.Path, tag.Slug, "index.html"), &Frontmatter{
+			Title:     tag.Name,
+			Templates: config.Templates,
+		})
+		page.Tag = tag
+		tag.URL = page.URL
+		pages = append(pages, page)
+	}
+
+	if len(config.IndexTemplates) > 0 {
+		page := newPage(filepath.Join(config.Path, "index.html"), &Frontmatter{
+			Title:     config.IndexTitle,
+			Templates: config.IndexTemplates,
+		})
+		site.TagsURL = page.URL
+		pages = append(pages, page)
+	}
+
+	return pages, nil
+}
+
+// slugify lowercases s and replaces every run of characters other than
+// letters and digits with a single dash.
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
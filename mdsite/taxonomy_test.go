@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := map[string]string{
+		"post":             "post",
+		"Go":               "go",
+		"Machine Learning": "machine-learning",
+		"  C++ / Rust  ":   "c-rust",
+		"books--2021":      "books-2021",
+		"Ünïcode Tag":      "ünïcode-tag",
+		"---":              "",
+	}
+	for input, want := range tests {
+		if got := slugify(input); got != want {
+			t.Errorf("slugify(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestTagURL(t *testing.T) {
+	pages := map[string][]*Page{
+		"post":  {{}, {}},
+		"books": {{}},
+	}
+	site := &Site{Tags: collectTags(pages)}
+
+	if len(site.Tags) != 2 || site.Tags[0].Name != "books" || site.Tags[1].Name != "post" {
+		t.Fatalf("collectTags should sort tags by name, got %v", site.Tags)
+	}
+
+	site.Tags[1].URL = "https://example.com/tags/post/"
+	if got := site.TagURL("post"); got != "https://example.com/tags/post/" {
+		t.Errorf("TagURL(post) = %q", got)
+	}
+	if got := site.TagURL("missing"); got != "" {
+		t.Errorf("TagURL(missing) = %q, want empty", got)
+	}
+}
+
+func TestTaxonomyPagesRejectsCollidingSlugs(t *testing.T) {
+	config := TaxonomyConfig{Path: "tags", Templates: []string{"templates/tag.html"}, IndexTemplates: []string{"templates/tags.html"}}
+	locatePage := func(relPath string) (string, string) {
+		return filepath.Join("/out", relPath), "https://example.com/" + filepath.ToSlash(relPath)
+	}
+
+	tests := []struct {
+		tags    []string
+		wantErr string
+	}{
+		{[]string{"go", "books"}, ""},
+		{[]string{"Go", "go"}, `Tags "Go" and "go" would both be listed on the page for "go"`},
+		{[]string{"C", "C++"}, `Tags "C" and "C++" would both be listed on the page for "c"`},
+		{[]string{"++"}, `Tag "++" has no letters or digits`},
+	}
+
+	for _, tt := range tests {
+		pagesByTag := map[string][]*Page{}
+		for _, name := range tt.tags {
+			pagesByTag[name] = []*Page{{}}
+		}
+		site := &Site{Tags: collectTags(pagesByTag)}
+
+		pages, err := taxonomyPages(site, "/site", config, locatePage)
+		if tt.wantErr == "" {
+			if err != nil || len(pages) != len(tt.tags)+1 {
+				t.Errorf("taxonomyPages(%q) = %d pages, %v", tt.tags, len(pages), err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+			t.Errorf("taxonomyPages(%q) error = %v, want %q", tt.tags, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// templateRegistry parses every template file and included partial once per
+// build. Pages get a clone of the combined set for their Templates list with
+// an Include function bound to the page.
+type templateRegistry struct {
+	rootDir string
+
+	// Assets looked up with Asset
+	assets *assetSet
+	// Resizes images for ImageSet
+	images *imageResizer
+
+	mu    sync.Mutex
+	files map[string]*parsedTemplate
+	sets  map[string]*parsedTemplate
+}
+
+type parsedTemplate struct {
+	tmpl *template.Template
+	err  error
+}
+
+func newTemplateRegistry(rootDir string) *templateRegistry {
+	return &templateRegistry{
+		rootDir: rootDir,
+		files:   map[string]*parsedTemplate{},
+		sets:    map[string]*parsedTemplate{},
+	}
+}
+
+// templateFuncs returns the functions available to every template. Include,
+// Asset, AssetIfExists, ImageSet, absURL and relURL are replaced with
+// page-bound versions before a template is executed.
+func templateFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		"Now":             now,
+		"TableOfContents": tableOfContents,
+		"Include": func(string) (string, error) {
+			return "", errors.New("Include called outside of a page")
+		},
+		"Asset": func(string) (*Asset, error) {
+			return nil, errors.New("Asset called outside of a page")
+		},
+		"AssetIfExists": func(string) (*Asset, error) {
+			return nil, errors.New("AssetIfExists called outside of a page")
+		},
+		"ImageSet": func(string) (*ImageSet, error) {
+			return nil, errors.New("ImageSet called outside of a page")
+		},
+	}
+	for name, fn := range libraryFuncs() {
+		funcs[name] = fn
+	}
+	for name, fn := range siteFuncs(nil) {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// pageFuncs returns the template functions bound to page for the template
+// file at filePath.
+func (r *templateRegistry) pageFuncs(filePath string, page *Page) template.FuncMap {
+	funcs := siteFuncs(page.Site)
+	funcs["Include"] = r.makeIncludeFunc(filePath, page)
+	funcs["Asset"] = func(name string) (*Asset, error) {
+		return r.assets.lookup(page, name, false)
+	}
+	funcs["AssetIfExists"] = func(name string) (*Asset, error) {
+		return r.assets.lookup(page, name, true)
+	}
+	funcs["ImageSet"] = func(src string) (*ImageSet, error) {
+		return r.images.imageSet(page, src)
+	}
+	return funcs
+}
+
+// checkAll parses every file under the site root matching patterns, so a
+// broken template is reported even when no page uses it yet.
+func (r *templateRegistry) checkAll(patterns []string) []error {
+	paths := []string{}
+	err := filepath.Walk(r.rootDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if isSkippedDir(filePath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relPath, err := filepath.Rel(r.rootDir, filePath)
+		if err != nil {
+			return err
+		}
+		if matchesAny(filepath.ToSlash(relPath), patterns) {
+			paths = append(paths, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return []error{fmt.Errorf("Error finding templates: %w", err)}
+	}
+
+	errs := []error{}
+	for _, filePath := range paths {
+		if _, err := r.file(filePath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// file returns the parsed template for a single template file.
+func (r *templateRegistry) file(filePath string) (*template.Template, error) {
+	filePath = filepath.Clean(filePath)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fileLocked(filePath)
+}
+
+func (r *templateRegistry) fileLocked(filePath string) (*template.Template, error) {
+	if p, ok := r.files[filePath]; ok {
+		return p.tmpl, p.err
+	}
+
+	p := &parsedTemplate{}
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		p.err = fmt.Errorf("Error reading template %s: %w", filePath, err)
+	} else {
+		p.tmpl, p.err = template.New(filepath.Base(filePath)).Funcs(templateFuncs()).Parse(string(content))
+		if p.err != nil {
+			p.err = fmt.Errorf("Error parsing template %s: %w", filePath, p.err)
+		}
+	}
+
+	r.files[filePath] = p
+	return p.tmpl, p.err
+}
+
+// trees returns the parse trees of a template file and every template it
+// defines.
+func (r *templateRegistry) trees(filePath string) ([]*parse.Tree, error) {
+	tmpl, err := r.file(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return templateTrees(tmpl), nil
+}
+
+// set combines the given template files in order, the same way
+// template.ParseFiles would, so later files override blocks of earlier ones.
+func (r *templateRegistry) set(filePaths []string) (*template.Template, error) {
+	key := strings.Join(filePaths, "\x00")
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p, ok := r.sets[key]; ok {
+		return p.tmpl, p.err
+	}
+
+	p := &parsedTemplate{tmpl: template.New("").Funcs(templateFuncs())}
+	for _, filePath := range filePaths {
+		fileTmpl, err := r.fileLocked(filepath.Clean(filePath))
+		if err != nil {
+			p.tmpl, p.err = nil, err
+			break
+		}
+		for _, tree := range templateTrees(fileTmpl) {
+			if _, err := p.tmpl.AddParseTree(tree.Name, tree); err != nil {
+				p.tmpl, p.err = nil, fmt.Errorf("Error combining template %s: %w", filePath, err)
+				break
+			}
+		}
+		if p.err != nil {
+			break
+		}
+	}
+
+	r.sets[key] = p
+	return p.tmpl, p.err
+}
+
+// pageTemplate returns a private copy of the template set listed in the
+// page's frontmatter, ready to execute for that page.
+func (r *templateRegistry) pageTemplate(page *Page) (*template.Template, error) {
+	templatePaths := make([]string, len(page.Frontmatter.Templates))
+	for i, p := range page.Frontmatter.Templates {
+		templatePaths[i] = filepath.Join(r.rootDir, p)
+	}
+
+	set, err := r.set(templatePaths)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing templates in file %s: %w", page.Path, err)
+	}
+
+	tmpl, err := set.Clone()
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing templates in file %s: %w", page.Path, err)
+	}
+
+	return tmpl.Funcs(r.pageFuncs(page.Path, page)), nil
+}
+
+// makeIncludeFunc returns the Include template function for page. Paths are
+// resolved relative to the file doing the including.
+func (r *templateRegistry) makeIncludeFunc(filePath string, page *Page) func(string) (string, error) {
+	return func(filename string) (string, error) {
+		currentDir := filepath.Dir(filePath)
+		includeFilePath := filepath.Join(currentDir, filename)
+		page.includes = append(page.includes, includeFilePath)
+
+		parsed, err := r.file(includeFilePath)
+		if err != nil {
+			return "", err
+		}
+
+		tmpl, err := parsed.Clone()
+		if err != nil {
+			return "", fmt.Errorf("Error parsing included file %s: %w", includeFilePath, err)
+		}
+		tmpl.Funcs(r.pageFuncs(includeFilePath, page))
+
+		var includeBuffer strings.Builder
+		if err := tmpl.Execute(&includeBuffer, page); err != nil {
+			return "", fmt.Errorf("Error rendering included file %s: %w", includeFilePath, err)
+		}
+
+		return includeBuffer.String(), nil
+	}
+}
+
+// templateTrees returns the parse trees of tmpl and its associated
+// templates, sorted by name so combining them is deterministic.
+func templateTrees(tmpl *template.Template) []*parse.Tree {
+	trees := []*parse.Tree{}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			trees = append(trees, t.Tree)
+		}
+	}
+	sort.Slice(trees, func(i, j int) bool {
+		return trees[i].Name < trees[j].Name
+	})
+	return trees
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateRegistryParsesOnce(t *testing.T) {
+	rootDir := writeFiles(t, map[string]string{
+		"templates/base.html":  `<h1>{{ .Title }}</h1>{{ Include "partials/nav.html" }}`,
+		"partials/nav.html":    `<nav>{{ .Title }}</nav>`,
+		"templates/other.html": `other`,
+	})
+	r := newTemplateRegistry(rootDir)
+	base := filepath.Join(rootDir, "templates", "base.html")
+
+	first, err := r.file(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Edits during a build are only picked up by the next one
+	if err := ioutil.WriteFile(base, []byte(`changed`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := r.file(base); again != first {
+		t.Error("file parsed a template twice")
+	}
+
+	set, err := r.set([]string{base})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := r.set([]string{base}); again != set {
+		t.Error("set combined the same templates twice")
+	}
+	if other, _ := r.set([]string{base, filepath.Join(rootDir, "templates", "other.html")}); other == set {
+		t.Error("set returned the same template for different lists")
+	}
+
+	render := func(page *Page) string {
+		t.Helper()
+		tmpl, err := r.pageTemplate(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tmpl == set {
+			t.Fatal("pageTemplate returned the shared set instead of a copy")
+		}
+		var b strings.Builder
+		if err := tmpl.ExecuteTemplate(&b, "base.html", page); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	// Each copy's Include is bound to its own page
+	one := &Page{Path: filepath.Join(rootDir, "one.md"), Frontmatter: &Frontmatter{Title: "One", Templates: []string{"templates/base.html"}}}
+	two := &Page{Path: filepath.Join(rootDir, "two.md"), Frontmatter: &Frontmatter{Title: "Two", Templates: []string{"templates/base.html"}}}
+	if got := render(one); got != "<h1>One</h1><nav>One</nav>" {
+		t.Errorf("one rendered %q", got)
+	}
+	if got := render(two); got != "<h1>Two</h1><nav>Two</nav>" {
+		t.Errorf("two rendered %q", got)
+	}
+	if len(one.includes) != 1 || len(two.includes) != 1 {
+		t.Errorf("includes = %v and %v, want one each", one.includes, two.includes)
+	}
+}
+
+func TestTemplateRegistryOverridesBlocks(t *testing.T) {
+	files := map[string]string{
+		"base.html": `<main>{{ block "main" . }}base{{ end }}</main>{{ block "footer" . }}footer{{ end }}`,
+		"page.html": `{{ define "main" }}page{{ end }}`,
+		"post.html": `{{ define "main" }}post{{ end }}{{ define "footer" }}post footer{{ end }}`,
+	}
+	rootDir := writeFiles(t, files)
+
+	for _, names := range [][]string{
+		{"base.html", "page.html"},
+		{"base.html", "post.html"},
+		{"base.html", "page.html", "post.html"},
+		{"page.html", "base.html"},
+	} {
+		paths := []string{}
+		for _, name := range names {
+			paths = append(paths, filepath.Join(rootDir, name))
+		}
+
+		want, err := template.ParseFiles(paths...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wantOut strings.Builder
+		if err := want.ExecuteTemplate(&wantOut, "base.html", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		set, err := newTemplateRegistry(rootDir).set(paths)
+		if err != nil {
+			t.Fatalf("set(%v) error: %v", names, err)
+		}
+		var got strings.Builder
+		if err := set.ExecuteTemplate(&got, "base.html", nil); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != wantOut.String() {
+			t.Errorf("set(%v) rendered %q, ParseFiles rendered %q", names, got.String(), wantOut.String())
+		}
+	}
+}
+
+func TestTemplateRegistryCheckAll(t *testing.T) {
+	rootDir := writeFiles(t, map[string]string{
+		"templates/base.html":    `{{ block "main" . }}{{ end }}`,
+		"templates/unused.html":  `{{ if .Title }}unclosed`,
+		"shortcodes/figure.html": `{{ .Params.src`,
+		"notes/draft.html":       `{{ not a template`,
+	})
+	r := newTemplateRegistry(rootDir)
+
+	errs := r.checkAll([]string{"templates/*", "shortcodes/*"})
+	got := []string{}
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	if len(got) != 2 ||
+		!strings.Contains(got[0], filepath.Join("shortcodes", "figure.html")) ||
+		!strings.Contains(got[1], filepath.Join("templates", "unused.html")) {
+		t.Errorf("checkAll reported %q, want the broken shortcode and template", got)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/gomarkdown/markdown/ast"
+)
+
+// Heading is an entry in a page's table of contents.
+type Heading struct {
+	Level    int
+	Text     string
+	ID       string
+	Children []*Heading
+}
+
+// buildTOC collects the headings of a parsed markdown document, nesting each
+// one under the closest preceding heading with a lower level.
+func buildTOC(doc ast.Node) []*Heading {
+	toc := []*Heading{}
+	stack := []*Heading{}
+
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		h, ok := node.(*ast.Heading)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		if h.IsTitleblock || h.HeadingID == "" {
+			return ast.SkipChildren
+		}
+
+		heading := &Heading{
+			Level:    h.Level,
+			Text:     headingText(h),
+			ID:       h.HeadingID,
+			Children: []*Heading{},
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].Level >= heading.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc = append(toc, heading)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, heading)
+		}
+		stack = append(stack, heading)
+
+		return ast.SkipChildren
+	})
+
+	return toc
+}
+
+// headingText returns the plain text of a heading, without any markup.
+func headingText(h *ast.Heading) string {
+	var b strings.Builder
+	ast.WalkFunc(h, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Text:
+			b.Write(n.Literal)
+		case *ast.Code:
+			b.Write(n.Literal)
+		}
+		return ast.GoToNext
+	})
+	return strings.TrimSpace(b.String())
+}
+
+// tableOfContents renders headings as nested lists of links to each
+// heading's anchor. It's available to templates as TableOfContents.
+func tableOfContents(headings []*Heading) string {
+	if len(headings) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(`<ul class="toc">`)
+	for _, h := range headings {
+		fmt.Fprintf(&b, `<li><a href="#%s">%s</a>`, html.EscapeString(h.ID), html.EscapeString(h.Text))
+		b.WriteString(tableOfContents(h.Children))
+		b.WriteString(`</li>`)
+	}
+	b.WriteString(`</ul>`)
+	return b.String()
+}
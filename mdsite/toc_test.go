@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/parser"
+)
+
+func TestBuildTOC(t *testing.T) {
+	md := `# Title
+
+## Fiction
+
+### Short *Stories*
+
+## Software
+
+### The ` + "`go`" + ` tool
+
+#### Modules
+
+## Fiction
+`
+	doc := markdown.Parse([]byte(md), parser.NewWithExtensions(parser.CommonExtensions|parser.AutoHeadingIDs))
+	toc := buildTOC(doc)
+
+	if len(toc) != 1 || toc[0].Text != "Title" || toc[0].ID != "title" {
+		t.Fatalf("expected a single top level heading, got %+v", toc)
+	}
+
+	sections := toc[0].Children
+	want := []struct {
+		text     string
+		id       string
+		children int
+	}{
+		{"Fiction", "fiction", 1},
+		{"Software", "software", 1},
+		{"Fiction", "fiction-1", 0},
+	}
+	if len(sections) != len(want) {
+		t.Fatalf("expected %d sections, got %d", len(want), len(sections))
+	}
+	for i, w := range want {
+		h := sections[i]
+		if h.Level != 2 || h.Text != w.text || h.ID != w.id || len(h.Children) != w.children {
+			t.Errorf("section %d = {%d %q %q %d children}, want {2 %q %q %d children}", i, h.Level, h.Text, h.ID, len(h.Children), w.text, w.id, w.children)
+		}
+	}
+
+	if got := sections[0].Children[0].Text; got != "Short Stories" {
+		t.Errorf("heading text should drop markup, got %q", got)
+	}
+	if got := sections[1].Children[0].Children[0].Text; got != "Modules" {
+		t.Errorf("expected Modules nested under the go tool, got %q", got)
+	}
+}
+
+func TestTableOfContents(t *testing.T) {
+	toc := []*Heading{
+		{Level: 2, Text: "Q&A", ID: "q-a", Children: []*Heading{
+			{Level: 3, Text: "Why?", ID: "why"},
+		}},
+	}
+	want := `<ul class="toc"><li><a href="#q-a">Q&amp;A</a><ul class="toc"><li><a href="#why">Why?</a></li></ul></li></ul>`
+	if got := tableOfContents(toc); got != want {
+		t.Errorf("tableOfContents\n got %s\nwant %s", got, want)
+	}
+	if got := tableOfContents(nil); got != "" {
+		t.Errorf("expected no output for an empty TOC, got %q", got)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchDebounce is how long the tree must go without changes before a
+// rebuild starts, so saving several files at once triggers a single build.
+const watchDebounce = 300 * time.Millisecond
+
+// fileState is what polling compares to notice a changed file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchSite builds the site, then polls its inputs every interval and
+// rebuilds after they change. The build cache limits each rebuild to the
+// pages whose markdown, templates or includes changed. Errors are logged and
+// watching continues, so a typo doesn't end the session.
+func watchSite(rootDir string, opts buildOptions, interval time.Duration) {
+	rebuild := func() {
+		if err := build(rootDir, opts); err != nil && err != errBuildFailed {
+			log.Printf("%v", err)
+		}
+		// -force only applies to the first build
+		opts.force = false
+	}
+
+	// Fall back to the last config that loaded while site.yaml is mid-edit
+	config := &Config{}
+	poll := func() map[string]fileState {
+		if c, err := loadConfig(rootDir); err == nil {
+			config = c
+		}
+		return watchedFiles(rootDir, opts.outDir, config)
+	}
+
+	snapshot := poll()
+	rebuild()
+	fmt.Printf("Watching %s for changes\n", rootDir)
+
+	for {
+		time.Sleep(interval)
+		next := poll()
+		changed := changedFiles(snapshot, next)
+		if len(changed) == 0 {
+			continue
+		}
+
+		for {
+			time.Sleep(watchDebounce)
+			settled := poll()
+			more := changedFiles(next, settled)
+			next = settled
+			if len(more) == 0 {
+				break
+			}
+			changed = append(changed, more...)
+		}
+
+		for _, path := range uniqueStrings(changed) {
+			fmt.Printf("Changed %s\n", path)
+		}
+
+		// Compare against the tree as it was before building, so edits
+		// made while the build runs trigger another one
+		snapshot = next
+		rebuild()
+	}
+}
+
+// watchedFiles returns the state of every input to the build: markdown,
+// site.yaml, frontmatter defaults, templates, data files, assets and files
+// pages included last time. Generated files are left out so building in place
+// doesn't trigger another build.
+func watchedFiles(rootDir, outDir string, config *Config) map[string]fileState {
+	patterns := append(append([]string{}, config.Templates...), config.Assets...)
+	dataDir := ""
+	if config.Data != "" {
+		dataDir = filepath.Join(rootDir, config.Data)
+	}
+	includes := cachedIncludes(rootDir, outDir)
+
+	files := map[string]fileState{}
+	filepath.Walk(rootDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Files can disappear between listing a directory and
+			// reading them, which the next poll picks up
+			return nil
+		}
+		if info.IsDir() {
+			if isSkippedDir(filePath) || (outDir != "" && isWithinDir(filePath, outDir)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(rootDir, filePath)
+		if err != nil {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		watched := strings.HasSuffix(filePath, ".md") ||
+			relPath == configFileName ||
+			info.Name() == defaultsFileName ||
+			matchesAny(relPath, patterns) ||
+			(dataDir != "" && isWithinDir(filePath, dataDir)) ||
+			includes[relPath]
+		if watched {
+			files[filePath] = fileState{info.ModTime(), info.Size()}
+		}
+		return nil
+	})
+	return files
+}
+
+// cachedIncludes returns the files any page included in the last build,
+// relative to the site root, as recorded in the build cache.
+func cachedIncludes(rootDir, outDir string) map[string]bool {
+	includes := map[string]bool{}
+	content, err := ioutil.ReadFile(manifestPath(rootDir, outDir))
+	if err != nil {
+		return includes
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return includes
+	}
+	for _, entry := range manifest.Pages {
+		for _, path := range entry.Includes {
+			includes[path] = true
+		}
+	}
+	return includes
+}
+
+// changedFiles returns the files added, removed or modified between two
+// polls, sorted by path.
+func changedFiles(prev, next map[string]fileState) []string {
+	changed := []string{}
+	for path, state := range next {
+		if old, ok := prev[path]; !ok || !old.modTime.Equal(state.modTime) || old.size != state.size {
+			changed = append(changed, path)
+		}
+	}
+	for path := range prev {
+		if _, ok := next[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
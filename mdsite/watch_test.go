@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestWatchedFiles(t *testing.T) {
+	rootDir := writeFiles(t, map[string]string{
+		configFileName:             "",
+		"rings/index.md":           "---\ntitle: Rings\n---\n",
+		"rings/index.html":         "<p>generated</p>",
+		"templates/base.html":      "{{ .Content }}",
+		"data/jobs.yaml":           "[]",
+		"node_modules/pkg/note.md": "ignored",
+		"rss.xml":                  "<rss></rss>",
+	})
+
+	config := &Config{Templates: []string{"templates/*"}, Data: "data"}
+	prev := watchedFiles(rootDir, "", config)
+	got := []string{}
+	for filePath := range prev {
+		rel, _ := filepath.Rel(rootDir, filePath)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	want := []string{"data/jobs.yaml", "rings/index.md", "site.yaml", "templates/base.html"}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("watchedFiles = %v, want %v", got, want)
+	}
+
+	// Writing generated files isn't a change, editing a template is
+	later := time.Now().Add(time.Minute)
+	for _, name := range []string{"rings/index.html", "rss.xml", "templates/base.html"} {
+		if err := os.Chtimes(filepath.Join(rootDir, filepath.FromSlash(name)), later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Remove(filepath.Join(rootDir, "data", "jobs.yaml"))
+
+	changed := changedFiles(prev, watchedFiles(rootDir, "", config))
+	wantChanged := []string{filepath.Join(rootDir, "data", "jobs.yaml"), filepath.Join(rootDir, "templates", "base.html")}
+	if !reflect.DeepEqual(changed, wantChanged) {
+		t.Errorf("changedFiles = %v, want %v", changed, wantChanged)
+	}
+}
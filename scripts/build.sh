@@ -2,6 +2,16 @@
 
 set -ex
 
-cd ./mdsite && go run ./mdsite.go ../
+# Set OUT_DIR to write the site to a separate directory instead of next to
+# each markdown file.
+OUT_DIR=${OUT_DIR:-}
 
+MDSITE_FLAGS=""
+if [ -n "$OUT_DIR" ]; then
+    MDSITE_FLAGS="-out ../$OUT_DIR"
+fi
+
+# Generate the stylesheet first so mdsite can fingerprint it
 yarn tailwindcss -i style.css -o tailwind.css
+
+cd ./mdsite && go run . $MDSITE_FLAGS "$@" ../
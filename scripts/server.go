@@ -1,23 +1,65 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
+// Path of the Server-Sent Events stream that tells pages to reload
+const reloadPath = "/_livereload"
+
+// reloadScript is injected into every HTML page. It reloads the page when
+// anything changes, or just refreshes its stylesheets when only CSS did.
+// Integrity attributes are dropped from swapped stylesheets since their
+// content no longer matches the hash.
+const reloadScript = `<script>
+(function () {
+  var source = new EventSource("` + reloadPath + `");
+  source.addEventListener("reload", function () {
+    location.reload();
+  });
+  source.addEventListener("css", function () {
+    document.querySelectorAll('link[rel="stylesheet"]').forEach(function (link) {
+      var url = new URL(link.href);
+      url.searchParams.set("livereload", Date.now());
+      var next = link.cloneNode();
+      next.removeAttribute("integrity");
+      next.href = url.href;
+      next.onload = function () { link.remove(); };
+      link.after(next);
+    });
+  });
+})();
+</script>
+`
+
 func main() {
 	// Define a command-line flag for the port
 	port := flag.String("port", "8081", "Port to listen on")
+	poll := flag.Duration("poll", 500*time.Millisecond, "How often to check for changed files to reload")
 	flag.Parse()
 
+	// Serve and watch the current directory
+	root := "."
+
 	// Create a file server handler serving from the current directory
-	fs := http.FileServer(http.Dir("."))
+	fs := http.FileServer(http.Dir(root))
+
+	// Tell connected pages to reload whenever files change
+	broker := newReloadBroker()
+	go watchFiles(root, *poll, broker.publish)
 
 	// Handle all requests with our logging middleware wrapped around the file server
-	http.Handle("/", noCacheHandler(logRequests(fs)))
+	http.Handle(reloadPath, broker)
+	http.Handle("/", noCacheHandler(logRequests(injectReloadScript(fs))))
 
 	// Print a message indicating on which port the server will listen
 	log.Printf("Starting server on port %s\n", *port)
@@ -48,3 +90,203 @@ func noCacheHandler(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// injectReloadScript wraps an http.Handler to add the reload client to the
+// end of the body of successful HTML responses.
+func injectReloadScript(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		iw := &injectWriter{ResponseWriter: w}
+		next.ServeHTTP(iw, r)
+		if iw.buf == nil {
+			return
+		}
+
+		body := iw.buf.Bytes()
+		if i := bytes.LastIndex(bytes.ToLower(body), []byte("</body>")); i >= 0 {
+			body = append(body[:i:i], append([]byte(reloadScript), body[i:]...)...)
+		} else {
+			body = append(body, reloadScript...)
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	})
+}
+
+// injectWriter holds back the body of HTML responses so the reload client
+// can be added to it. Everything else is passed straight through.
+type injectWriter struct {
+	http.ResponseWriter
+	// Set once the response is known to be HTML
+	buf         *bytes.Buffer
+	wroteHeader bool
+}
+
+func (w *injectWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if status == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		// The length changes once the script is added
+		w.Header().Del("Content-Length")
+		w.buf = &bytes.Buffer{}
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *injectWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.buf != nil {
+		return w.buf.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// reloadBroker streams reload events to every connected page.
+type reloadBroker struct {
+	mu      sync.Mutex
+	clients map[chan string]bool
+}
+
+func newReloadBroker() *reloadBroker {
+	return &reloadBroker{clients: map[chan string]bool{}}
+}
+
+// publish sends event to every connected page. Pages that haven't read the
+// previous event yet are skipped since they're about to reload anyway.
+func (b *reloadBroker) publish(event string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.clients {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *reloadBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := make(chan string, 1)
+	b.mu.Lock()
+	b.clients[ch] = true
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, ch)
+		b.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// Comments keep idle connections from being closed by proxies
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-ch:
+			fmt.Fprintf(w, "event: %s\ndata: \n\n", event)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// watchFiles polls the files under root every interval and calls notify
+// with "css" when only stylesheets changed, or "reload" for anything else.
+// Changes are collected until the tree settles so a rebuild writing many
+// files causes a single reload.
+func watchFiles(root string, interval time.Duration, notify func(string)) {
+	snapshot := scanFiles(root)
+	for {
+		time.Sleep(interval)
+		next := scanFiles(root)
+		changed := changedFiles(snapshot, next)
+		if len(changed) == 0 {
+			continue
+		}
+
+		for {
+			time.Sleep(interval)
+			settled := scanFiles(root)
+			more := changedFiles(next, settled)
+			next = settled
+			if len(more) == 0 {
+				break
+			}
+			changed = append(changed, more...)
+		}
+		snapshot = next
+
+		event := "css"
+		for _, path := range changed {
+			if filepath.Ext(path) != ".css" {
+				event = "reload"
+				break
+			}
+		}
+		log.Printf("Sending %s for %d changed files\n", event, len(changed))
+		notify(event)
+	}
+}
+
+// scanFiles returns the modification time of every file under root, skipping
+// dependencies and hidden files such as the build cache.
+func scanFiles(root string) map[string]time.Time {
+	files := map[string]time.Time{}
+	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if name == "node_modules" || (strings.HasPrefix(name, ".") && path != root) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(name, ".") {
+			files[path] = info.ModTime()
+		}
+		return nil
+	})
+	return files
+}
+
+// changedFiles returns the files added, removed or modified between two
+// scans.
+func changedFiles(prev, next map[string]time.Time) []string {
+	changed := []string{}
+	for path, modTime := range next {
+		if old, ok := prev[path]; !ok || !old.Equal(modTime) {
+			changed = append(changed, path)
+		}
+	}
+	for path := range prev {
+		if _, ok := next[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	return changed
+}